@@ -4,6 +4,25 @@ import "math/big"
 
 var PreHertzBlockNumber uint64 = 2   // a block number to run the pre-Hertz test cases
 var PostHertzBlockNumber uint64 = 12 // a block number to run post-Hertz test cases
+var HertzBlockNumber uint64 = 10     // the block height of berlinBlock, londonBlock and hertzBlock in the genesis config
 var ChainId = big.NewInt(1337)
 var SenderPrivateKeyHex = "9b28f36fbd67381120752d6172ecdcf10e06ab2d9a1367aac00cdcd6ac7855d3"
 var ReceiverPrivateKeyHex = "ddcd272732bfe889da92201da3527cb0faa4f3be06f5baa9e9269b700dfa2c2c"
+var ParliaEpoch uint64 = 200          // the parlia epoch length in the genesis config
+var FeeHistoryMaxHeaderHistory = 1024 // [Eth.GPO] MaxHeaderHistory of node.toml, max blocks of eth_feeHistory without reward percentiles
+var FeeHistoryMaxBlockHistory = 1024  // [Eth.GPO] MaxBlockHistory of node.toml, max blocks of eth_feeHistory with reward percentiles
+
+// Gas price settings of the node, they must match its --miner.gasprice and --gpo.* flags
+var MinerGasPrice = big.NewInt(1_000_000_000) // --miner.gasprice, also the default price of the gas price oracle
+var GpoBlocks = 20                            // --gpo.blocks
+var GpoPercentile = 60                        // --gpo.percentile
+var GpoMaxPrice = big.NewInt(100_000_000_000) // --gpo.maxprice
+var GpoIgnorePrice = big.NewInt(4)            // --gpo.ignoreprice
+var GpoOracleThreshold = 0                    // [Eth.GPO] OracleThreshold of node.toml, the oracle only uses the percentile with more samples than this
+
+// Transaction pool settings of the node, they must match its --txpool.* flags
+var TxPoolPriceBump int64 = 10 // --txpool.pricebump, the percentage both the fee cap and the tip of a replacement must be raised by
+var TxPoolNoLocals = false     // --txpool.nolocals, unless it is set transactions sent over RPC are local and exempt from the minimum gas price
+
+// RPC settings of the node, they must match its --rpc.* flags
+var RPCAllowUnprotectedTxs = true // --rpc.allow-unprotected-txs, unless it is set legacy transactions without EIP-155 replay protection are refused
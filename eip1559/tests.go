@@ -14,11 +14,15 @@ import (
 	"math/big"
 
 	// "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type TestCase struct {
@@ -30,9 +34,64 @@ var senderPrivateKey *ecdsa.PrivateKey
 var senderAddress common.Address
 var receiverPrivateKey *ecdsa.PrivateKey
 var receiverAddress common.Address
+var rpcClient *rpc.Client
 var client *ethclient.Client
 var err error
 
+// Init code of a contract that burns all the gas it is given except for ~5000:
+// runtime code: JUMPDEST PUSH2 0x1388 GAS GT PUSH1 0x00 JUMPI STOP
+var gasBurnerBytecode = common.FromHex("0x600a600c600039600a6000f35b6113885a1160005700")
+
+// Init code that returns the BASEFEE of the block it is executed in as a 32 byte word:
+// BASEFEE PUSH1 0x00 MSTORE PUSH1 0x20 PUSH1 0x00 RETURN
+var baseFeeReturningBytecode = common.FromHex("0x4860005260206000f3")
+
+// Contract from the genesis alloc with the code PC PC SLOAD SLOAD. With its storage
+// empty it reads the slots 1 and 0.
+var storageReaderAddress = common.HexToAddress("0x7B31188CA9C1374AC9174C3D1F23F98180CBB67C")
+
+// A DynamicFeeTx calling the storage reader with an access list. warmSlots is the
+// number of slots read by the contract that are in the access list.
+type AccessListCase struct {
+	name       string
+	accessList types.AccessList
+	warmSlots  uint64
+}
+
+// The cases are built after init since they refer to the receiver
+func accessListCases() []AccessListCase {
+	return []AccessListCase{
+		{
+			name:       "no access list",
+			accessList: nil,
+			warmSlots:  0,
+		},
+		{
+			name:       "contract without slots",
+			accessList: types.AccessList{{Address: storageReaderAddress, StorageKeys: nil}},
+			warmSlots:  0,
+		},
+		{
+			name:       "contract with slot 0",
+			accessList: types.AccessList{{Address: storageReaderAddress, StorageKeys: []common.Hash{common.BigToHash(common.Big0)}}},
+			warmSlots:  1,
+		},
+		{
+			name:       "contract with slots 0 and 1",
+			accessList: types.AccessList{{Address: storageReaderAddress, StorageKeys: []common.Hash{common.BigToHash(common.Big0), common.BigToHash(common.Big1)}}},
+			warmSlots:  2,
+		},
+		{
+			name:       "slots 0 and 1 of another account",
+			accessList: types.AccessList{{Address: receiverAddress, StorageKeys: []common.Hash{common.BigToHash(common.Big0), common.BigToHash(common.Big1)}}},
+			warmSlots:  0,
+		},
+	}
+}
+
+// Number of consecutive blocks to fill above the gas target
+var fullBlocksCount = 10
+
 func init() {
 	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
 	if err != nil {
@@ -44,11 +103,13 @@ func init() {
 		log.Fatal(err)
 	}
 
-	// Connect to an Ethereum client
-	client, err = ethclient.Dial("http://localhost:8545")
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts for the fee accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
 	if err != nil {
 		log.Fatal(err)
 	}
+	client = ethclient.NewClient(rpcClient)
 
 	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
 	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
@@ -99,25 +160,29 @@ func sendDynamicFeeTx(gasFeeCap, gasTipCap *big.Int) (common.Hash, error) {
 	// Set the amount of ETH to transfer
 	value := big.NewInt(1000000000000000000) // 1 ETH
 
+	log.Println("GasFeeCap: ", gasFeeCap)
+	log.Println("GasTipCap: ", gasTipCap)
+	gasLimit := uint64(21000) // Standard gas limit for a transfer
+
+	return sendDynamicFeeTxWithAccessList(receiverAddress, value, gasLimit, gasFeeCap, gasTipCap, nil)
+}
+
+func sendDynamicFeeTxWithAccessList(to common.Address, value *big.Int, gasLimit uint64, gasFeeCap, gasTipCap *big.Int, accessList types.AccessList) (common.Hash, error) {
 	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
 	if err != nil {
 		return common.Hash{}, err
 	}
 
-	log.Println("GasFeeCap: ", gasFeeCap)
-	log.Println("GasTipCap: ", gasTipCap)
-	gasLimit := uint64(21000) // Standard gas limit for a transfer
-
 	tx := types.NewTx(&types.DynamicFeeTx{
 		ChainID:    config.ChainId,
 		Nonce:      nonce,
-		To:         &receiverAddress,
+		To:         &to,
 		Value:      value,
 		Gas:        gasLimit,
 		GasFeeCap:  gasFeeCap,
 		GasTipCap:  gasTipCap,
 		Data:       []byte{},
-		AccessList: nil,
+		AccessList: accessList,
 	})
 
 	// Sign the transaction with the sender's private key
@@ -189,6 +254,112 @@ func sendSmallGasTipCapDynamicFeeTx() (common.Hash, error) {
 	return sendDynamicFeeTx(gasPrice, gasTipCap)
 }
 
+// Gas used by a call to the storage reader: the intrinsic gas with the access list,
+// two PC and two SLOADs that cost 100 for a slot warmed by the access list and 2100
+// for a cold slot
+func storageReaderGas(accessListCase AccessListCase) uint64 {
+	gas := params.TxGas
+	gas += uint64(len(accessListCase.accessList)) * params.TxAccessListAddressGas
+	gas += uint64(accessListCase.accessList.StorageKeys()) * params.TxAccessListStorageKeyGas
+	gas += 2 * vm.GasQuickStep
+	gas += accessListCase.warmSlots * params.WarmStorageReadCostEIP2929
+	gas += (2 - accessListCase.warmSlots) * params.ColdSloadCostEIP2929
+	return gas
+}
+
+// Deploys the gas burner contract and returns its address
+func deployGasBurner() (common.Address, error) {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return common.Address{}, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return common.Address{}, err
+	}
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      100_000,
+		Value:    big.NewInt(0),
+		Data:     gasBurnerBytecode,
+	})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return common.Address{}, err
+	}
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	receipt, err := utils.WaitForTransactionReceipt(client, signedTx.Hash())
+	if err != nil {
+		return common.Address{}, err
+	}
+	if receipt.Status != 1 {
+		return common.Address{}, fmt.Errorf("gas burner deployment failed. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.CreateAddress(senderAddress, nonce), nil
+}
+
+// Sends count DynamicFeeTxs to the gas burner, each with a gas limit above the gas
+// target of the current block so that no two of them fit in the same block
+func sendGasBurningTxs(gasBurner common.Address, count int) ([]common.Hash, error) {
+	header, err := client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	gasTipCap, err := client.SuggestGasTipCap(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return nil, err
+	}
+	gasLimit := header.GasLimit * 55 / 100
+
+	txHashes := make([]common.Hash, count)
+	for i := 0; i < count; i++ {
+		tx := types.NewTx(&types.DynamicFeeTx{
+			ChainID:   config.ChainId,
+			Nonce:     nonce + uint64(i),
+			To:        &gasBurner,
+			Value:     big.NewInt(0),
+			Gas:       gasLimit,
+			GasFeeCap: gasTipCap,
+			GasTipCap: gasTipCap,
+			Data:      []byte{},
+		})
+		signedTx, err := types.SignTx(tx, types.NewLondonSigner(config.ChainId), senderPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		err = client.SendTransaction(context.Background(), signedTx)
+		if err != nil {
+			return nil, err
+		}
+		txHashes[i] = signedTx.Hash()
+	}
+	return txHashes, nil
+}
+
+// Executes the BASEFEE opcode with eth_call on top of the given block
+func baseFeeOpcodeAt(blockNr *big.Int) (*big.Int, error) {
+	result, err := client.CallContract(context.Background(), ethereum.CallMsg{
+		From: senderAddress,
+		Data: baseFeeReturningBytecode,
+	}, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(result), nil
+}
+
 // PRE-HERTZ TEST CASES
 
 func testLegacyTxPreHertz() error {
@@ -217,44 +388,37 @@ func testLegacyTxPreHertz() error {
 	if baseFee != nil {
 		return fmt.Errorf("BaseFee is not nil at pre-Hertz block number %v", blockNr)
 	}
-	return nil
+	return utils.VerifyFeeAccounting(rpcClient, txHash)
 }
 
 func testDefaultDynamicFeeTxPreHertz() error {
 	_, err := sendDefaultDynamicTx(false)
 	// DynamicFeeTx before Hertz should give ErrTxTypeNotSupported
-	if err == nil {
-		return fmt.Errorf("expected ErrTxTypeNotSupported but got no error instead")
-	}
-	if err != nil && err.Error() != types.ErrTxTypeNotSupported.Error() {
-		return fmt.Errorf("expected ErrTxTypeNotSupported but got '%v' instead", err)
-	}
-	return nil
+	return utils.SentinelError(types.ErrTxTypeNotSupported).Match(err)
 }
 
 func testSmallGasFeeCapDynamicFeeTxPreHertz() error {
 	_, err := sendSmallGasFeeCapDynamicFeeTx()
 	// DynamicFeeTx before Hertz should give ErrTxTypeNotSupported
-	if err == nil {
-		return fmt.Errorf("expected ErrTxTypeNotSupported but got no error instead")
-	}
-	if err != nil && err.Error() != types.ErrTxTypeNotSupported.Error() {
-		return fmt.Errorf("expected ErrTxTypeNotSupported but got '%v' instead", err)
-	}
-	return nil
+	return utils.SentinelError(types.ErrTxTypeNotSupported).Match(err)
 }
 
 func testSmallGasTipCapDynamicFeeTxPreHertz() error {
 	_, err := sendSmallGasTipCapDynamicFeeTx()
 	// DynamicFeeTx before Hertz should give ErrTxTypeNotSupported
-	if err == nil {
-		return fmt.Errorf("expected ErrTxTypeNotSupported but got no error instead")
-	}
-	if err != nil && err.Error() != types.ErrTxTypeNotSupported.Error() {
-		return fmt.Errorf("expected ErrTxTypeNotSupported but got '%v' instead", err)
-	}
-	return nil
+	return utils.SentinelError(types.ErrTxTypeNotSupported).Match(err)
+}
 
+func testAccessListDynamicFeeTxPreHertz() error {
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return err
+	}
+	// The case with slot 0 of the storage reader
+	accessListCase := accessListCases()[2]
+	_, err = sendDynamicFeeTxWithAccessList(storageReaderAddress, big.NewInt(0), storageReaderGas(accessListCase), gasPrice, gasPrice, accessListCase.accessList)
+	// DynamicFeeTx before Hertz should give ErrTxTypeNotSupported
+	return utils.SentinelError(types.ErrTxTypeNotSupported).Match(err)
 }
 
 func testSuggestedPricesPreHertz() error {
@@ -306,7 +470,7 @@ func testLegacyTxPostHertz() error {
 	if baseFee == nil || baseFee.Cmp(common.Big0) != 0 {
 		return fmt.Errorf("BaseFee is not 0 at post-Hertz block number %v", blockNr)
 	}
-	return nil
+	return utils.VerifyFeeAccounting(rpcClient, txHash)
 }
 
 func testDefaultDynamicFeeTxPostHertz() error {
@@ -352,7 +516,7 @@ func testDefaultDynamicFeeTxPostHertz() error {
 		return fmt.Errorf("BaseFee is not 0 at post-Hertz block number %v", blockNr)
 	}
 
-	return nil
+	return utils.VerifyFeeAccounting(rpcClient, txHash)
 }
 
 // Send a DynamicFeeTx with GasTipCap < GasFeeCap
@@ -391,17 +555,148 @@ func testSmallGasTipCapDynamicFeeTxPostHertz() error {
 		return fmt.Errorf("gas price should be equal to gas fee cap. gasPrice=%v, gasFeeCap =%v, gasTipCap =%v", gasPrice, gasFeeCap, gasTipCap)
 	}
 
-	return nil
+	// With a zero base fee the transaction pays its tip, not its fee cap
+	effectiveGasPrice, err := utils.EffectiveGasPrice(rpcClient, txHash)
+	if err != nil {
+		return err
+	}
+	if effectiveGasPrice.Cmp(gasTipCap) != 0 {
+		return fmt.Errorf("effectiveGasPrice should be equal to gas tip cap. effectiveGasPrice=%v, gasTipCap =%v", effectiveGasPrice, gasTipCap)
+	}
+	return utils.VerifyFeeAccounting(rpcClient, txHash)
 }
 
 // Send a DynamicFeeTx with GasFeeCap < GasTipCap
 func testSmallGasFeeCapDynamicFeeTxPostHertz() error {
 	_, err := sendSmallGasFeeCapDynamicFeeTx()
-	if err == nil {
-		return fmt.Errorf("expected ErrTipAboveFeeCap but got no error instead")
+	return utils.SentinelError(core.ErrTipAboveFeeCap).Match(err)
+}
+
+// Calls the storage reader with DynamicFeeTxs carrying different access lists. Each
+// transaction has to pay its tip per gas since the base fee is 0, and has to use
+// exactly the gas of the EIP-2930 rules: the access list is paid upfront and makes
+// the listed slots warm.
+func testAccessListDynamicFeeTxPostHertz() error {
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return err
+	}
+	gasTipCap := big.NewInt(0).Quo(gasPrice, big.NewInt(2))
+
+	// Send all the cases at once so that they are mined in a few blocks
+	cases := accessListCases()
+	txHashes := make([]common.Hash, len(cases))
+	for i, accessListCase := range cases {
+		txHashes[i], err = sendDynamicFeeTxWithAccessList(storageReaderAddress, big.NewInt(0), storageReaderGas(accessListCase)+10_000, gasPrice, gasTipCap, accessListCase.accessList)
+		if err != nil {
+			return fmt.Errorf("%s: %v", accessListCase.name, err)
+		}
+	}
+
+	for i, accessListCase := range cases {
+		receipt, err := utils.WaitForTransactionReceipt(client, txHashes[i])
+		if err != nil {
+			return err
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("%s: receipt.Status != 1. Receipt: %+v", accessListCase.name, receipt)
+		}
+		if receipt.Type != types.DynamicFeeTxType {
+			return fmt.Errorf("%s: receipt type is %d, expected %d", accessListCase.name, receipt.Type, types.DynamicFeeTxType)
+		}
+		tx, _, err := client.TransactionByHash(context.Background(), txHashes[i])
+		if err != nil {
+			return err
+		}
+		if tx.AccessList().StorageKeys() != accessListCase.accessList.StorageKeys() || len(tx.AccessList()) != len(accessListCase.accessList) {
+			return fmt.Errorf("%s: transaction was mined with access list %v", accessListCase.name, tx.AccessList())
+		}
+
+		// EIP-2930: the access list is charged upfront and the listed slots are warm
+		if expected := storageReaderGas(accessListCase); receipt.GasUsed != expected {
+			return fmt.Errorf("%s: transaction used %d gas, expected %d", accessListCase.name, receipt.GasUsed, expected)
+		}
+
+		// EIP-1559: with a zero base fee the transaction pays its tip, not its fee cap
+		block, err := client.BlockByNumber(context.Background(), receipt.BlockNumber)
+		if err != nil {
+			return err
+		}
+		if block.BaseFee() == nil || block.BaseFee().Sign() != 0 {
+			return fmt.Errorf("BaseFee is not 0 at post-Hertz block number %v", receipt.BlockNumber)
+		}
+		effectiveGasPrice, err := utils.EffectiveGasPrice(rpcClient, txHashes[i])
+		if err != nil {
+			return err
+		}
+		if effectiveGasPrice.Cmp(gasTipCap) != 0 {
+			return fmt.Errorf("%s: effectiveGasPrice should be equal to gas tip cap. effectiveGasPrice=%v, gasTipCap =%v", accessListCase.name, effectiveGasPrice, gasTipCap)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, txHashes[i])
+		if err != nil {
+			return fmt.Errorf("%s: %v", accessListCase.name, err)
+		}
+		log.Printf("%s: used %d gas\n", accessListCase.name, receipt.GasUsed)
+	}
+	return nil
+}
+
+// Fills consecutive blocks above the gas target. With EIP-1559 the base fee would
+// rise after every one of them, with Hertz it has to stay 0.
+func testBaseFeeZeroUnderFullBlocksPostHertz() error {
+	gasBurner, err := deployGasBurner()
+	if err != nil {
+		return err
+	}
+	txHashes, err := sendGasBurningTxs(gasBurner, fullBlocksCount)
+	if err != nil {
+		return err
+	}
+
+	var firstBlock, lastBlock uint64
+	for i, txHash := range txHashes {
+		receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+		if err != nil {
+			return err
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, txHash)
+		if err != nil {
+			return err
+		}
+		blockNr := receipt.BlockNumber.Uint64()
+		if i == 0 {
+			firstBlock = blockNr
+		}
+		lastBlock = blockNr
+	}
+	log.Printf("Gas burning transactions were mined in blocks %d to %d\n", firstBlock, lastBlock)
+
+	// Also check the block after the last full one, whose base fee is derived from it
+	err = utils.WaitForBlockNumber(client, lastBlock+1)
+	if err != nil {
+		return err
 	}
-	if err != nil && err.Error() != core.ErrTipAboveFeeCap.Error() {
-		return fmt.Errorf("expected ErrTipAboveFeeCap but got '%v' instead", err)
+	for blockNr := firstBlock; blockNr <= lastBlock+1; blockNr++ {
+		header, err := client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(blockNr))
+		if err != nil {
+			return err
+		}
+		if blockNr <= lastBlock && header.GasUsed <= header.GasLimit/params.ElasticityMultiplier {
+			return fmt.Errorf("block %d used %d gas which is not above the gas target %d", blockNr, header.GasUsed, header.GasLimit/params.ElasticityMultiplier)
+		}
+		if header.BaseFee == nil || header.BaseFee.Sign() != 0 {
+			return fmt.Errorf("BaseFee is %v at post-Hertz block number %d after full blocks, expected 0", header.BaseFee, blockNr)
+		}
+		baseFee, err := baseFeeOpcodeAt(header.Number)
+		if err != nil {
+			return err
+		}
+		if baseFee.Sign() != 0 {
+			return fmt.Errorf("BASEFEE opcode returned %v at post-Hertz block number %d, expected 0", baseFee, blockNr)
+		}
 	}
 	return nil
 }
@@ -434,6 +729,10 @@ func runPreHertzTests() {
 			name:               "testSmallGasTipCapDynamicFeeTxPreHertz",
 			validationFunction: testSmallGasTipCapDynamicFeeTxPreHertz,
 		},
+		{
+			name:               "testAccessListDynamicFeeTxPreHertz",
+			validationFunction: testAccessListDynamicFeeTxPreHertz,
+		},
 		{
 			name:               "testSuggestedPricesPreHertz",
 			validationFunction: testSuggestedPricesPreHertz,
@@ -474,10 +773,18 @@ func runPostHertzTests() {
 			name:               "testSmallGasFeeCapDynamicFeeTxPostHertz",
 			validationFunction: testSmallGasFeeCapDynamicFeeTxPostHertz,
 		},
+		{
+			name:               "testAccessListDynamicFeeTxPostHertz",
+			validationFunction: testAccessListDynamicFeeTxPostHertz,
+		},
 		{
 			name:               "testSuggestedPricesPostHertz",
 			validationFunction: testSuggestedPricesPostHertz,
 		},
+		{
+			name:               "testBaseFeeZeroUnderFullBlocksPostHertz",
+			validationFunction: testBaseFeeZeroUnderFullBlocksPostHertz,
+		},
 	}
 	runTestCasesSequentially(testCases)
 }
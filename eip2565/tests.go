@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// A MODEXP call with the given lengths. The lengths in the input header are the
+// declared ones, the base, exponent and modulus are left-padded to them.
+type ModExpCase struct {
+	name                    string
+	baseLen, expLen, modLen uint64
+	base, exp, mod          *big.Int
+}
+
+// Address of the MODEXP precompile
+var modExpAddress = common.BytesToAddress([]byte{5})
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+// RSA-like moduli of different sizes. They only need to be odd and to fill
+// their declared length, primality is irrelevant for the gas cost.
+var modulus256 = oddModulus(32)
+var modulus1024 = oddModulus(128)
+var modulus2048 = oddModulus(256)
+var modulus4096 = oddModulus(512)
+
+var modExpCases = []ModExpCase{
+	{name: "1-byte operands", baseLen: 1, expLen: 1, modLen: 1, base: big.NewInt(3), exp: big.NewInt(5), mod: big.NewInt(7)},
+	{name: "zero exponent", baseLen: 32, expLen: 32, modLen: 32, base: big.NewInt(2), exp: big.NewInt(0), mod: modulus256},
+	{name: "256-bit, e=65537", baseLen: 32, expLen: 3, modLen: 32, base: big.NewInt(0xbeef), exp: big.NewInt(65537), mod: modulus256},
+	{name: "256-bit, full exponent", baseLen: 32, expLen: 32, modLen: 32, base: big.NewInt(0xbeef), exp: new(big.Int).Sub(modulus256, common.Big2), mod: modulus256},
+	{name: "exponent longer than 32 bytes", baseLen: 32, expLen: 64, modLen: 32, base: big.NewInt(0xbeef), exp: new(big.Int).Lsh(big.NewInt(0xff), 400), mod: modulus256},
+	{name: "RSA-1024 verification", baseLen: 128, expLen: 3, modLen: 128, base: big.NewInt(0xdead), exp: big.NewInt(65537), mod: modulus1024},
+	{name: "RSA-2048 verification", baseLen: 256, expLen: 3, modLen: 256, base: big.NewInt(0xdead), exp: big.NewInt(65537), mod: modulus2048},
+	{name: "RSA-2048 signing", baseLen: 256, expLen: 256, modLen: 256, base: big.NewInt(0xdead), exp: new(big.Int).Sub(modulus2048, common.Big2), mod: modulus2048},
+	{name: "RSA-4096 verification", baseLen: 512, expLen: 3, modLen: 512, base: big.NewInt(0xdead), exp: big.NewInt(65537), mod: modulus4096},
+	{name: "base longer than modulus", baseLen: 64, expLen: 1, modLen: 8, base: new(big.Int).Lsh(common.Big1, 500), exp: big.NewInt(3), mod: big.NewInt(1_000_003)},
+}
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts for the fee accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+}
+
+// Returns an odd number whose big-endian encoding is exactly size bytes long
+func oddModulus(size int) *big.Int {
+	b := bytes.Repeat([]byte{0xab}, size)
+	b[0] = 0xc5
+	b[size-1] = 0x3f
+	return new(big.Int).SetBytes(b)
+}
+
+// Encodes the MODEXP input: <baseLen><expLen><modLen><base><exp><mod>
+func (c ModExpCase) input() []byte {
+	input := make([]byte, 0, 96+c.baseLen+c.expLen+c.modLen)
+	input = append(input, common.LeftPadBytes(new(big.Int).SetUint64(c.baseLen).Bytes(), 32)...)
+	input = append(input, common.LeftPadBytes(new(big.Int).SetUint64(c.expLen).Bytes(), 32)...)
+	input = append(input, common.LeftPadBytes(new(big.Int).SetUint64(c.modLen).Bytes(), 32)...)
+	input = append(input, common.LeftPadBytes(c.base.Bytes(), int(c.baseLen))...)
+	input = append(input, common.LeftPadBytes(c.exp.Bytes(), int(c.expLen))...)
+	input = append(input, common.LeftPadBytes(c.mod.Bytes(), int(c.modLen))...)
+	return input
+}
+
+// The expected output of the precompile: base**exp % mod left-padded to modLen
+func (c ModExpCase) expectedOutput() []byte {
+	if c.mod.Sign() == 0 {
+		return make([]byte, c.modLen)
+	}
+	result := new(big.Int).Exp(c.base, c.exp, c.mod)
+	return common.LeftPadBytes(result.Bytes(), int(c.modLen))
+}
+
+// adjusted_exponent_length as defined in EIP-198 and reused by EIP-2565:
+// the index of the highest set bit of the first 32 bytes of the exponent,
+// plus 8 bits for every exponent byte after the first 32.
+func (c ModExpCase) adjustedExpLen() *big.Int {
+	expBytes := common.LeftPadBytes(c.exp.Bytes(), int(c.expLen))
+	head := expBytes
+	if len(head) > 32 {
+		head = head[:32]
+	}
+	adjExpLen := new(big.Int)
+	if bitLen := new(big.Int).SetBytes(head).BitLen(); bitLen > 0 {
+		adjExpLen.SetInt64(int64(bitLen - 1))
+	}
+	if c.expLen > 32 {
+		adjExpLen.Add(adjExpLen, new(big.Int).SetUint64(8*(c.expLen-32)))
+	}
+	return adjExpLen
+}
+
+// Gas cost of the MODEXP precompile before Berlin (EIP-198):
+// floor(mult_complexity(max(baseLen, modLen)) * max(adjExpLen, 1) / 20)
+func (c ModExpCase) eip198Gas() uint64 {
+	x := new(big.Int).SetUint64(c.baseLen)
+	if c.modLen > c.baseLen {
+		x.SetUint64(c.modLen)
+	}
+	xSquared := new(big.Int).Mul(x, x)
+	var complexity *big.Int
+	switch {
+	case x.Cmp(big.NewInt(64)) <= 0:
+		complexity = xSquared
+	case x.Cmp(big.NewInt(1024)) <= 0:
+		// x**2 // 4 + 96 * x - 3072
+		complexity = new(big.Int).Div(xSquared, big.NewInt(4))
+		complexity.Add(complexity, new(big.Int).Mul(big.NewInt(96), x))
+		complexity.Sub(complexity, big.NewInt(3072))
+	default:
+		// x**2 // 16 + 480 * x - 199680
+		complexity = new(big.Int).Div(xSquared, big.NewInt(16))
+		complexity.Add(complexity, new(big.Int).Mul(big.NewInt(480), x))
+		complexity.Sub(complexity, big.NewInt(199680))
+	}
+	iterations := c.adjustedExpLen()
+	if iterations.Sign() == 0 {
+		iterations.SetInt64(1)
+	}
+	gas := new(big.Int).Mul(complexity, iterations)
+	return gas.Div(gas, big.NewInt(20)).Uint64()
+}
+
+// Gas cost of the MODEXP precompile after Berlin (EIP-2565):
+// max(200, floor(ceil(max(baseLen, modLen) / 8)**2 * max(adjExpLen, 1) / 3))
+func (c ModExpCase) eip2565Gas() uint64 {
+	maxLen := c.baseLen
+	if c.modLen > maxLen {
+		maxLen = c.modLen
+	}
+	words := new(big.Int).SetUint64((maxLen + 7) / 8)
+	complexity := new(big.Int).Mul(words, words)
+	iterations := c.adjustedExpLen()
+	if iterations.Sign() == 0 {
+		iterations.SetInt64(1)
+	}
+	gas := new(big.Int).Mul(complexity, iterations)
+	gas.Div(gas, big.NewInt(3))
+	if gas.Cmp(big.NewInt(200)) < 0 {
+		return 200
+	}
+	return gas.Uint64()
+}
+
+// Returns the precompile gas the node should charge for a call in the given block
+func (c ModExpCase) expectedGas(blockNr *big.Int) uint64 {
+	if blockNr.Uint64() < config.HertzBlockNumber {
+		return c.eip198Gas()
+	}
+	return c.eip2565Gas()
+}
+
+// Intrinsic gas of a call transaction with the given data after Istanbul
+func intrinsicGas(data []byte) uint64 {
+	gas := params.TxGas
+	for _, b := range data {
+		if b == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	return gas
+}
+
+// Sends a legacy transaction calling the MODEXP precompile directly with the given nonce.
+// The gas limit covers the more expensive of the two formulas so that the same
+// transaction succeeds on either side of the fork.
+func sendModExpTx(nonce uint64, modExpCase ModExpCase) (common.Hash, error) {
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	input := modExpCase.input()
+	precompileGas := modExpCase.eip198Gas()
+	if gas := modExpCase.eip2565Gas(); gas > precompileGas {
+		precompileGas = gas
+	}
+	gasLimit := intrinsicGas(input) + precompileGas + 10_000
+
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      gasLimit,
+		To:       &modExpAddress,
+		Value:    big.NewInt(0),
+		Data:     input,
+	})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return signedTx.Hash(), err
+	}
+	return signedTx.Hash(), nil
+}
+
+// Checks that the precompile returns base**exp % mod for the case
+func checkModExpOutput(modExpCase ModExpCase) error {
+	output, err := client.CallContract(context.Background(), ethereum.CallMsg{
+		From: senderAddress,
+		To:   &modExpAddress,
+		Data: modExpCase.input(),
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(output, modExpCase.expectedOutput()) {
+		return fmt.Errorf("unexpected MODEXP output for case '%s': expected %x, got %x", modExpCase.name, modExpCase.expectedOutput(), output)
+	}
+	return nil
+}
+
+// Sends all MODEXP cases in a row so that they get mined close to each other and
+// checks the gas charged for each of them against the formula active in its block.
+// If wantEIP2565 is true all transactions should be mined on or after the Hertz block,
+// otherwise before it.
+func checkModExpGas(wantEIP2565 bool) error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	txHashes := make([]common.Hash, len(modExpCases))
+	for i, modExpCase := range modExpCases {
+		txHashes[i], err = sendModExpTx(nonce+uint64(i), modExpCase)
+		if err != nil {
+			return fmt.Errorf("failed to send MODEXP case '%s': %v", modExpCase.name, err)
+		}
+	}
+
+	for i, modExpCase := range modExpCases {
+		receipt, err := utils.WaitForTransactionReceipt(client, txHashes[i])
+		if err != nil {
+			return err
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("receipt.Status != 1 for MODEXP case '%s'. Receipt: %+v", modExpCase.name, receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return fmt.Errorf("MODEXP case '%s': %v", modExpCase.name, err)
+		}
+		isPostHertz := receipt.BlockNumber.Uint64() >= config.HertzBlockNumber
+		if isPostHertz != wantEIP2565 {
+			return fmt.Errorf("MODEXP case '%s' was mined in block %v which is on the wrong side of the Hertz block %v", modExpCase.name, receipt.BlockNumber, config.HertzBlockNumber)
+		}
+
+		precompileGas := modExpCase.expectedGas(receipt.BlockNumber)
+		expected := intrinsicGas(modExpCase.input()) + precompileGas
+		log.Printf("MODEXP case '%s': EIP-198 gas = %d, EIP-2565 gas = %d, gas used = %d\n", modExpCase.name, modExpCase.eip198Gas(), modExpCase.eip2565Gas(), receipt.GasUsed)
+		if receipt.GasUsed != expected {
+			return fmt.Errorf("incorrect amount of gas spent for MODEXP case '%s' in block %v: expected %d (precompile gas %d), got %d", modExpCase.name, receipt.BlockNumber, expected, precompileGas, receipt.GasUsed)
+		}
+	}
+	return nil
+}
+
+// PRE-HERTZ TEST CASES
+
+func testModExpGasPreHertz() error {
+	return checkModExpGas(false)
+}
+
+// POST-HERTZ TEST CASES
+
+func testModExpGasPostHertz() error {
+	return checkModExpGas(true)
+}
+
+// The repricing must not change the result of the precompile
+func testModExpOutputPostHertz() error {
+	for _, modExpCase := range modExpCases {
+		err := checkModExpOutput(modExpCase)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testModExpGasPreHertz",
+			validationFunction: testModExpGasPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testModExpGasPostHertz",
+			validationFunction: testModExpGasPostHertz,
+		},
+		{
+			name:               "testModExpOutputPostHertz",
+			validationFunction: testModExpOutputPostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
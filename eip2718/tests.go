@@ -0,0 +1,711 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// A raw payload for eth_sendRawTransaction that the node must refuse to decode
+type MalformedTxCase struct {
+	name        string
+	payload     []byte
+	expectedErr utils.ExpectedError
+}
+
+// Runtime code of the contracts created by typed transactions, it returns 42:
+// PUSH1 0x2a PUSH1 0x00 MSTORE PUSH1 0x20 PUSH1 0x00 RETURN
+var runtimeCode = common.FromHex("0x602a60005260206000f3")
+
+// Init code that deploys runtimeCode:
+// PUSH1 len DUP1 PUSH1 0x0b PUSH1 0x00 CODECOPY PUSH1 0x00 RETURN <runtimeCode>
+var creationCode = append(common.FromHex("0x600a80600b6000396000f3"), runtimeCode...)
+
+// Gas used by executing creationCode: 24 for the opcodes and memory, and 200 per
+// byte of deployed code
+const creationExecutionGas = 24 + params.CreateDataGas*10
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var receiverPrivateKey *ecdsa.PrivateKey
+var receiverAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	receiverPrivateKey, err = crypto.HexToECDSA(config.ReceiverPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to send payloads
+	// that can't be represented as a types.Transaction.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
+}
+
+// Sends the given bytes as they are with eth_sendRawTransaction
+func sendRawTransaction(payload []byte) (common.Hash, error) {
+	var txHash common.Hash
+	err := rpcClient.CallContext(context.Background(), &txHash, "eth_sendRawTransaction", hexutil.Encode(payload))
+	return txHash, err
+}
+
+func signedLegacyTx(nonce uint64) (*types.Transaction, error) {
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      21000,
+		To:       &receiverAddress,
+		Value:    big.NewInt(1),
+		Data:     []byte{},
+	})
+	return types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+}
+
+func signedAccessListTx(nonce uint64) (*types.Transaction, error) {
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	tx := types.NewTx(&types.AccessListTx{
+		ChainID:  config.ChainId,
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      30000,
+		To:       &receiverAddress,
+		Value:    big.NewInt(1),
+		Data:     []byte{},
+		AccessList: types.AccessList{{
+			Address:     receiverAddress,
+			StorageKeys: []common.Hash{{0}},
+		}},
+	})
+	return types.SignTx(tx, types.NewEIP2930Signer(config.ChainId), senderPrivateKey)
+}
+
+func signedDynamicFeeTx(nonce uint64) (*types.Transaction, error) {
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   config.ChainId,
+		Nonce:     nonce,
+		GasFeeCap: gasPrice,
+		GasTipCap: gasPrice,
+		Gas:       21000,
+		To:        &receiverAddress,
+		Value:     big.NewInt(1),
+		Data:      []byte{},
+	})
+	return types.SignTx(tx, types.NewLondonSigner(config.ChainId), senderPrivateKey)
+}
+
+// Intrinsic gas of a contract creation with the given init code and access list
+func creationIntrinsicGas(data []byte, accessList types.AccessList) uint64 {
+	gas := params.TxGasContractCreation
+	for _, b := range data {
+		if b == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	gas += uint64(len(accessList)) * params.TxAccessListAddressGas
+	gas += uint64(accessList.StorageKeys()) * params.TxAccessListStorageKeyGas
+	return gas
+}
+
+// Returns a builder of typed transactions that create a contract with creationCode.
+// If prewarm is set, the access list contains the address the contract will be
+// created at and its first storage slot.
+func creationTxBuilder(txType byte, prewarm bool) func(nonce uint64) (*types.Transaction, error) {
+	return func(nonce uint64) (*types.Transaction, error) {
+		gasPrice, err := client.SuggestGasPrice(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		var accessList types.AccessList
+		if prewarm {
+			accessList = types.AccessList{{
+				Address:     crypto.CreateAddress(senderAddress, nonce),
+				StorageKeys: []common.Hash{{0}},
+			}}
+		}
+		return utils.SignNewTx(txType, utils.TxParams{
+			Nonce:      nonce,
+			GasFeeCap:  gasPrice,
+			GasTipCap:  gasPrice,
+			Gas:        100000,
+			Value:      big.NewInt(0),
+			Data:       creationCode,
+			AccessList: accessList,
+		}, senderPrivateKey)
+	}
+}
+
+// Builds the malformed envelopes from validly signed transactions with the given nonce,
+// so that the only reason for a rejection is the encoding itself.
+func malformedTxCases(nonce uint64) ([]MalformedTxCase, error) {
+	legacyTx, err := signedLegacyTx(nonce)
+	if err != nil {
+		return nil, err
+	}
+	accessListTx, err := signedAccessListTx(nonce)
+	if err != nil {
+		return nil, err
+	}
+	legacyBytes, err := legacyTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	accessListBytes, err := accessListTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	// The RLP payload of the typed transaction without its type byte
+	accessListPayload := accessListBytes[1:]
+
+	return []MalformedTxCase{
+		{
+			name:        "unknown type 0x03",
+			payload:     append([]byte{0x03}, accessListPayload...),
+			expectedErr: utils.SentinelError(types.ErrTxTypeNotSupported),
+		},
+		{
+			name:        "highest typed transaction type 0x7f",
+			payload:     append([]byte{0x7f}, accessListPayload...),
+			expectedErr: utils.SentinelError(types.ErrTxTypeNotSupported),
+		},
+		{
+			// Bytes above 0x7f are read as the start of a legacy RLP list, 0x80 is an RLP string
+			name:        "type byte 0x80",
+			payload:     append([]byte{0x80}, accessListPayload...),
+			expectedErr: utils.ErrorMessage("rlp: expected input list for types.LegacyTx"),
+		},
+		{
+			name:        "type byte 0xc0",
+			payload:     append([]byte{0xc0}, accessListPayload...),
+			expectedErr: utils.ErrorMessage("rlp: too few elements for types.LegacyTx"),
+		},
+		{
+			name:        "legacy transaction wrapped in an envelope",
+			payload:     append([]byte{types.LegacyTxType}, legacyBytes...),
+			expectedErr: utils.SentinelError(types.ErrTxTypeNotSupported),
+		},
+		{
+			name:        "truncated legacy transaction",
+			payload:     legacyBytes[:len(legacyBytes)-5],
+			expectedErr: utils.SentinelError(rlp.ErrValueTooLarge),
+		},
+		{
+			name:        "truncated access list transaction",
+			payload:     accessListBytes[:len(accessListBytes)-5],
+			expectedErr: utils.SentinelError(rlp.ErrValueTooLarge),
+		},
+		{
+			name:        "legacy transaction with trailing bytes",
+			payload:     append(append([]byte{}, legacyBytes...), 0x00),
+			expectedErr: utils.SentinelError(rlp.ErrMoreThanOneValue),
+		},
+		{
+			name:        "access list transaction with trailing bytes",
+			payload:     append(append([]byte{}, accessListBytes...), 0x00),
+			expectedErr: utils.SentinelError(rlp.ErrMoreThanOneValue),
+		},
+	}, nil
+}
+
+// Envelope decoding happens before any fork dependent validation, so the errors
+// are the same before and after Hertz
+func testMalformedEnvelopes() error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	malformedCases, err := malformedTxCases(nonce)
+	if err != nil {
+		return err
+	}
+	for _, malformedCase := range malformedCases {
+		_, err := sendRawTransaction(malformedCase.payload)
+		err = malformedCase.expectedErr.Match(err)
+		if err != nil {
+			return fmt.Errorf("%s: %v", malformedCase.name, err)
+		}
+	}
+
+	// None of the payloads must have reached the pool
+	pendingNonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	if pendingNonce != nonce {
+		return fmt.Errorf("pending nonce changed from %d to %d after sending malformed transactions", nonce, pendingNonce)
+	}
+	return nil
+}
+
+// Sends a correctly encoded transaction with eth_sendRawTransaction and checks that
+// both the receipt and the transaction report its type
+func sendRawAndCheckType(buildTx func(nonce uint64) (*types.Transaction, error)) error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	tx, err := buildTx(nonce)
+	if err != nil {
+		return err
+	}
+	payload, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	txHash, err := sendRawTransaction(payload)
+	if err != nil {
+		return err
+	}
+	if txHash != tx.Hash() {
+		return fmt.Errorf("eth_sendRawTransaction returned hash %v, expected %v", txHash, tx.Hash())
+	}
+
+	receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+	}
+	if receipt.Type != tx.Type() {
+		return fmt.Errorf("receipt type is %d, expected %d", receipt.Type, tx.Type())
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return err
+	}
+
+	minedTx, isPending, err := client.TransactionByHash(context.Background(), txHash)
+	if err != nil {
+		return err
+	}
+	if isPending {
+		return fmt.Errorf("transaction %v should not be pending", txHash)
+	}
+	if minedTx.Type() != tx.Type() {
+		return fmt.Errorf("eth_getTransactionByHash reports type %d, expected %d", minedTx.Type(), tx.Type())
+	}
+	return nil
+}
+
+// Sends a correctly encoded typed transaction that should be refused by the pool
+func sendRawAndExpectTypeNotSupported(buildTx func(nonce uint64) (*types.Transaction, error)) error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	tx, err := buildTx(nonce)
+	if err != nil {
+		return err
+	}
+	payload, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = sendRawTransaction(payload)
+	return utils.SentinelError(types.ErrTxTypeNotSupported).Match(err)
+}
+
+// Recomputes the transactions root and the receipts root of a block from the
+// transactions and receipts served over RPC and compares them to the header
+func verifyBlockRoots(blockNr *big.Int) error {
+	block, err := client.BlockByNumber(context.Background(), blockNr)
+	if err != nil {
+		return err
+	}
+	txs := block.Transactions()
+	receipts := make(types.Receipts, len(txs))
+	for i, tx := range txs {
+		receipts[i], err = client.TransactionReceipt(context.Background(), tx.Hash())
+		if err != nil {
+			return fmt.Errorf("failed to get receipt of transaction %v in block %v: %v", tx.Hash(), blockNr, err)
+		}
+		if receipts[i].Type != tx.Type() {
+			return fmt.Errorf("receipt of transaction %v has type %d, expected %d", tx.Hash(), receipts[i].Type, tx.Type())
+		}
+	}
+
+	txRoot := types.DeriveSha(txs, trie.NewStackTrie(nil))
+	if txRoot != block.TxHash() {
+		return fmt.Errorf("transactions root of block %v is %v, recomputed %v from %d transactions", blockNr, block.TxHash(), txRoot, len(txs))
+	}
+	receiptRoot := types.DeriveSha(receipts, trie.NewStackTrie(nil))
+	if receiptRoot != block.ReceiptHash() {
+		return fmt.Errorf("receipts root of block %v is %v, recomputed %v from %d receipts", blockNr, block.ReceiptHash(), receiptRoot, len(receipts))
+	}
+	log.Printf("Verified transactions root and receipts root of block %v with %d transactions\n", blockNr, len(txs))
+	return nil
+}
+
+// Number of times the mixed transactions are resent when they are split over blocks
+const mixedBlockAttempts = 5
+
+// Sends a legacy, an access list and a dynamic fee transaction back to back until
+// all three are mined in the same block, then verifies the roots of that block
+func testMixedBlockTrieRootsPostHertz() error {
+	for attempt := 1; attempt <= mixedBlockAttempts; attempt++ {
+		blockNr, err := sendMixedTransactions()
+		if err != nil {
+			return err
+		}
+		if blockNr == nil {
+			log.Printf("The transactions were split over several blocks, resending them (attempt %d of %d)\n", attempt, mixedBlockAttempts)
+			continue
+		}
+		return verifyBlockRoots(blockNr)
+	}
+	return fmt.Errorf("the transactions were split over several blocks in all %d attempts", mixedBlockAttempts)
+}
+
+// Sends one transaction of each type and returns the number of the block that
+// includes all of them, or nil if they were split over several blocks
+func sendMixedTransactions() (*big.Int, error) {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return nil, err
+	}
+	builders := []func(nonce uint64) (*types.Transaction, error){signedLegacyTx, signedAccessListTx, signedDynamicFeeTx}
+	txs := make([]*types.Transaction, len(builders))
+	for i, buildTx := range builders {
+		txs[i], err = buildTx(nonce + uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		err = client.SendTransaction(context.Background(), txs[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var blockNr *big.Int
+	split := false
+	for _, tx := range txs {
+		receipt, err := utils.WaitForTransactionReceipt(client, tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if receipt.Status != 1 {
+			return nil, fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return nil, err
+		}
+		if blockNr == nil {
+			blockNr = receipt.BlockNumber
+		} else if blockNr.Cmp(receipt.BlockNumber) != 0 {
+			split = true
+		}
+	}
+	if split {
+		return nil, nil
+	}
+
+	block, err := client.BlockByNumber(context.Background(), blockNr)
+	if err != nil {
+		return nil, err
+	}
+	txTypes := make(map[uint8]bool)
+	for _, tx := range block.Transactions() {
+		txTypes[tx.Type()] = true
+	}
+	for _, tx := range txs {
+		if !txTypes[tx.Type()] {
+			return nil, fmt.Errorf("block %v doesn't contain a transaction of type %d", blockNr, tx.Type())
+		}
+	}
+	return blockNr, nil
+}
+
+// Sends a typed contract creation and checks that the contract is created at the
+// address derived from the sender and the nonce, and that the transaction pays the
+// intrinsic gas of a creation with its access list on top of the init code execution.
+// Warming the created address doesn't save any gas since a creation warms it anyway.
+func sendAndVerifyCreation(buildTx func(nonce uint64) (*types.Transaction, error)) error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	tx, err := buildTx(nonce)
+	if err != nil {
+		return err
+	}
+	err = client.SendTransaction(context.Background(), tx)
+	if err != nil {
+		return err
+	}
+	receipt, err := utils.WaitForTransactionReceipt(client, tx.Hash())
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+	}
+	if receipt.Type != tx.Type() {
+		return fmt.Errorf("receipt type is %d, expected %d", receipt.Type, tx.Type())
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return err
+	}
+
+	minedTx, _, err := client.TransactionByHash(context.Background(), tx.Hash())
+	if err != nil {
+		return err
+	}
+	if minedTx.To() != nil {
+		return fmt.Errorf("contract creation was mined with recipient %v", minedTx.To())
+	}
+	if len(minedTx.AccessList()) != len(tx.AccessList()) {
+		return fmt.Errorf("contract creation was mined with %d access list entries, expected %d", len(minedTx.AccessList()), len(tx.AccessList()))
+	}
+
+	contractAddress := crypto.CreateAddress(senderAddress, nonce)
+	if receipt.ContractAddress != contractAddress {
+		return fmt.Errorf("receipt reports contract address %v, expected %v", receipt.ContractAddress, contractAddress)
+	}
+	code, err := client.CodeAt(context.Background(), contractAddress, receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(code, runtimeCode) {
+		return fmt.Errorf("code at %v is %v, expected %v", contractAddress, common.Bytes2Hex(code), common.Bytes2Hex(runtimeCode))
+	}
+
+	intrinsicGas := creationIntrinsicGas(tx.Data(), tx.AccessList())
+	if expected := intrinsicGas + creationExecutionGas; receipt.GasUsed != expected {
+		return fmt.Errorf("contract creation used %d gas, expected %d intrinsic gas and %d for the init code", receipt.GasUsed, intrinsicGas, creationExecutionGas)
+	}
+	return nil
+}
+
+// PRE-HERTZ TEST CASES
+
+var testMalformedEnvelopesPreHertz = testMalformedEnvelopes
+
+func testRawLegacyTxPreHertz() error {
+	return sendRawAndCheckType(signedLegacyTx)
+}
+
+func testRawAccessListTxPreHertz() error {
+	return sendRawAndExpectTypeNotSupported(signedAccessListTx)
+}
+
+func testRawDynamicFeeTxPreHertz() error {
+	return sendRawAndExpectTypeNotSupported(signedDynamicFeeTx)
+}
+
+func testAccessListCreationPreHertz() error {
+	return sendRawAndExpectTypeNotSupported(creationTxBuilder(types.AccessListTxType, true))
+}
+
+func testDynamicFeeCreationPreHertz() error {
+	return sendRawAndExpectTypeNotSupported(creationTxBuilder(types.DynamicFeeTxType, true))
+}
+
+// POST-HERTZ TEST CASES
+
+var testMalformedEnvelopesPostHertz = testMalformedEnvelopes
+
+func testRawLegacyTxPostHertz() error {
+	return sendRawAndCheckType(signedLegacyTx)
+}
+
+func testRawAccessListTxPostHertz() error {
+	return sendRawAndCheckType(signedAccessListTx)
+}
+
+func testRawDynamicFeeTxPostHertz() error {
+	return sendRawAndCheckType(signedDynamicFeeTx)
+}
+
+func testAccessListCreationPostHertz() error {
+	return sendAndVerifyCreation(creationTxBuilder(types.AccessListTxType, false))
+}
+
+func testPrewarmedAccessListCreationPostHertz() error {
+	return sendAndVerifyCreation(creationTxBuilder(types.AccessListTxType, true))
+}
+
+func testDynamicFeeCreationPostHertz() error {
+	return sendAndVerifyCreation(creationTxBuilder(types.DynamicFeeTxType, false))
+}
+
+func testPrewarmedDynamicFeeCreationPostHertz() error {
+	return sendAndVerifyCreation(creationTxBuilder(types.DynamicFeeTxType, true))
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testMalformedEnvelopesPreHertz",
+			validationFunction: testMalformedEnvelopesPreHertz,
+		},
+		{
+			name:               "testRawAccessListTxPreHertz",
+			validationFunction: testRawAccessListTxPreHertz,
+		},
+		{
+			name:               "testRawDynamicFeeTxPreHertz",
+			validationFunction: testRawDynamicFeeTxPreHertz,
+		},
+		{
+			name:               "testAccessListCreationPreHertz",
+			validationFunction: testAccessListCreationPreHertz,
+		},
+		{
+			name:               "testDynamicFeeCreationPreHertz",
+			validationFunction: testDynamicFeeCreationPreHertz,
+		},
+		{
+			name:               "testRawLegacyTxPreHertz",
+			validationFunction: testRawLegacyTxPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testMalformedEnvelopesPostHertz",
+			validationFunction: testMalformedEnvelopesPostHertz,
+		},
+		{
+			name:               "testRawLegacyTxPostHertz",
+			validationFunction: testRawLegacyTxPostHertz,
+		},
+		{
+			name:               "testRawAccessListTxPostHertz",
+			validationFunction: testRawAccessListTxPostHertz,
+		},
+		{
+			name:               "testRawDynamicFeeTxPostHertz",
+			validationFunction: testRawDynamicFeeTxPostHertz,
+		},
+		{
+			name:               "testMixedBlockTrieRootsPostHertz",
+			validationFunction: testMixedBlockTrieRootsPostHertz,
+		},
+		{
+			name:               "testAccessListCreationPostHertz",
+			validationFunction: testAccessListCreationPostHertz,
+		},
+		{
+			name:               "testPrewarmedAccessListCreationPostHertz",
+			validationFunction: testPrewarmedAccessListCreationPostHertz,
+		},
+		{
+			name:               "testDynamicFeeCreationPostHertz",
+			validationFunction: testDynamicFeeCreationPostHertz,
+		},
+		{
+			name:               "testPrewarmedDynamicFeeCreationPostHertz",
+			validationFunction: testPrewarmedDynamicFeeCreationPostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type TestCase struct {
@@ -27,6 +28,7 @@ var senderPrivateKey *ecdsa.PrivateKey
 var senderAddress common.Address
 var receiverPrivateKey *ecdsa.PrivateKey
 var receiverAddress common.Address
+var rpcClient *rpc.Client
 var client *ethclient.Client
 var err error
 
@@ -41,11 +43,13 @@ func init() {
 		log.Fatal(err)
 	}
 
-	// Connect to an Ethereum client
-	client, err = ethclient.Dial("http://localhost:8545")
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts for the fee accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
 	if err != nil {
 		log.Fatal(err)
 	}
+	client = ethclient.NewClient(rpcClient)
 
 	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
 	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
@@ -157,7 +161,7 @@ func testSendAccessListTx() error {
 	if block.GasUsed() != expected {
 		return fmt.Errorf("incorrect amount of gas spent: expected %d, got %d", expected, block.GasUsed())
 	}
-	return nil
+	return utils.VerifyFeeAccounting(rpcClient, txHash)
 }
 
 // Runs the slice of test cases sequentially
@@ -207,13 +211,7 @@ func preHertzTests() {
 
 func testSendAccessListPreHertz() error {
 	_, err := sendAccessListTx()
-	if err == nil {
-		return fmt.Errorf("expected ErrTxTypeNotSupported but got `no error` instead")
-	}
-	if err != nil && err.Error() != types.ErrTxTypeNotSupported.Error() {
-		return fmt.Errorf("expected ErrTxTypeNotSupported but got '%v' instead", err)
-	}
-	return nil
+	return utils.SentinelError(types.ErrTxTypeNotSupported).Match(err)
 }
 
 func postHertzTests() {
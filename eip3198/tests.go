@@ -13,14 +13,18 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type Contract struct {
@@ -30,10 +34,67 @@ type Contract struct {
 
 var CONTRACT_JSON_PATH = "./contracts/BaseFee.json"
 
+// Init code of a contract that stores BASEFEE in a mined transaction, assembled by
+// hand like the contracts below. BaseFee.sol only reads BASEFEE in calls. The
+// constructor sets slot 0 to 2^256-1, so that storing a base fee of 0 can be observed.
+// The runtime code dispatches on the selector and reverts on calls with value:
+//   - basefee_global() and basefee_inline_assembly() return BASEFEE
+//   - stored_basefee() returns slot 0
+//   - store_basefee() stores BASEFEE in slot 0 and emits BaseFeeStored(BASEFEE)
+var baseFeeStorageBytecode = common.FromHex("0x60001960005534610018576100948061001d6000396000f35b600080fd6004361061003a5760003560e01c80639436dce41461003f578063d6210d341461003f5780635c432eee1461004e578063d81ce90c1461005f575b600080fd5b3461003a574860005260206000f35b3461003a5760005460005260206000f35b3461003a5748806000556000527ff0ee2c373ce751be4ac6ffbea0ebc05859338e756b240e6d9c1d0f828123f7c860206000a100")
+
+const baseFeeStorageABIJSON = `[
+	{"anonymous":false,"inputs":[{"indexed":false,"internalType":"uint256","name":"basefee","type":"uint256"}],"name":"BaseFeeStored","type":"event"},
+	{"inputs":[],"name":"store_basefee","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[],"name":"stored_basefee","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"stateMutability":"view","type":"function"}
+]`
+
+// Init code of a contract that executes BASEFEE in its constructor, stores it in slot 0
+// and emits it as the data of a LOG0:
+// BASEFEE DUP1 PUSH1 0x00 SSTORE PUSH1 0x00 MSTORE PUSH1 0x20 PUSH1 0x00 LOG0 <return runtime>
+// Its runtime code returns the stored value followed by BASEFEE of the current block:
+// PUSH1 0x00 SLOAD PUSH1 0x00 MSTORE BASEFEE PUSH1 0x20 MSTORE PUSH1 0x40 PUSH1 0x00 RETURN
+var baseFeeChildBytecode = common.FromHex("0x488060005560005260206000a0600f8060186000396000f36000546000524860205260406000f3")
+
+// Init code of a contract that executes BASEFEE in a nested context chosen by the first
+// calldata word, emits the result as the data of a LOG0 and returns it. It reverts if
+// the nested context fails.
+//   - callerModeStaticCall:   STATICCALL basefee_global() of the contract in the second word
+//   - callerModeDelegateCall: DELEGATECALL basefee_global() of the contract in the second word
+//   - callerModeCreate2:      CREATE2 baseFeeChildBytecode with the second word as salt and
+//     STATICCALL the child, returning both of its words
+var baseFeeCallerBytecode = common.FromHex("0x6100c280600c6000396000f36000358060011461002057806002146100445780600314610068575b600080fd5b639436dce460e01b60005260206000600460006020355afa1561001b576020610093565b639436dce460e01b60005260206000600460006020355af41561001b576020610093565b602761009b600039602035602760006000f5801561001b576040600060006000845afa1561001b5760405b806000a06000f3488060005560005260206000a0600f8060186000396000f36000546000524860205260406000f3")
+
+const (
+	callerModeStaticCall   = 1
+	callerModeDelegateCall = 2
+	callerModeCreate2      = 3
+)
+
+var callerModes = []int64{callerModeStaticCall, callerModeDelegateCall, callerModeCreate2}
+
+// CREATE2 salt used in eth_call, mined transactions use small salts so they never collide with it
+var callSalt = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+
+// Error of eth_call executing BASEFEE before Hertz
+var invalidBaseFeeOpcode = utils.ExpectedError{Code: utils.DefaultErrorCode, Message: "invalid opcode: BASEFEE", Mode: utils.MatchExact}
+
+// Init code that reverts with BASEFEE as revert data:
+// BASEFEE PUSH1 0x00 MSTORE PUSH1 0x20 PUSH1 0x00 REVERT
+var baseFeeRevertBytecode = common.FromHex("0x4860005260206000fd")
+
+// Error of eth_call when the caller reverts without data after a failed nested context
+var nestedFailure = utils.ExpectedError{Code: utils.DefaultErrorCode, Message: "execution reverted", Mode: utils.MatchExact}
+
+// Address the BaseFee runtime code is placed at with a state override in historical eth_calls
+var overrideAddress = common.HexToAddress("0x000000000000000000000000000000000000ba5e")
+
 var senderPrivateKey *ecdsa.PrivateKey
 var senderAddress common.Address
+var rpcClient *rpc.Client
 var client *ethclient.Client
 var baseFeeContract Contract
+var baseFeeStorageABI abi.ABI
 var err error
 
 func init() {
@@ -42,11 +103,13 @@ func init() {
 		log.Fatal(err)
 	}
 
-	// Connect to an Ethereum client
-	client, err = ethclient.Dial("http://localhost:8545")
+	// Connect to an Ethereum client. The raw RPC client is needed for eth_call with
+	// state overrides.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
 	if err != nil {
 		log.Fatal(err)
 	}
+	client = ethclient.NewClient(rpcClient)
 
 	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
 
@@ -66,6 +129,11 @@ func init() {
 	json.Unmarshal(bytes, &baseFeeContract)
 	log.Printf("contract.ABI:\n %v\n\n", baseFeeContract.ABI)
 	log.Printf("contract.Bin:\n  %v\n\n", baseFeeContract.Bin)
+
+	baseFeeStorageABI, err = abi.JSON(strings.NewReader(baseFeeStorageABIJSON))
+	if err != nil {
+		log.Fatalf("Failed to parse the ABI of the storage contract: %v", err)
+	}
 }
 
 func openFile(filename string) (*os.File, error) {
@@ -119,8 +187,9 @@ func deployContract(bytecode []byte) (common.Hash, common.Address, error) {
 	return signedTx.Hash(), contractAddress, nil
 }
 
-func deployBaseFeeContract() (common.Hash, common.Address, error) {
-	txHash, contractAddress, err := deployContract(common.FromHex(baseFeeContract.Bin))
+// Deploys a contract and checks that it has code. Returns (txHash, contractAddress, error)
+func deployAndVerifyContract(bytecode []byte) (common.Hash, common.Address, error) {
+	txHash, contractAddress, err := deployContract(bytecode)
 	if err != nil {
 		return common.Hash{}, common.Address{}, err
 	}
@@ -134,6 +203,10 @@ func deployBaseFeeContract() (common.Hash, common.Address, error) {
 		err = fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
 		return txHash, contractAddress, err
 	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return txHash, contractAddress, err
+	}
 
 	deployedCode, err := client.CodeAt(context.Background(), contractAddress, nil)
 	if err != nil {
@@ -147,39 +220,337 @@ func deployBaseFeeContract() (common.Hash, common.Address, error) {
 	return txHash, contractAddress, nil
 }
 
-func testBaseFeeGlobalPreHertz(boundContract *bind.BoundContract) error {
+// Sends a transaction of the given type calling store_basefee() of the storage
+// contract and returns its hash
+func sendStoreBaseFeeTx(contractAddress common.Address, txType uint8) (common.Hash, error) {
+	data, err := baseFeeStorageABI.Pack("store_basefee")
+	if err != nil {
+		return common.Hash{}, err
+	}
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	signedTx, err := utils.SignNewTx(txType, utils.TxParams{
+		Nonce:     nonce,
+		GasFeeCap: gasPrice,
+		GasTipCap: gasPrice,
+		Gas:       100_000,
+		To:        &contractAddress,
+		Value:     big.NewInt(0),
+		Data:      data,
+	}, senderPrivateKey)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return signedTx.Hash(), nil
+}
+
+// Returns stored_basefee() of the storage contract at the given block
+func storedBaseFeeAt(storageContract *bind.BoundContract, blockNr *big.Int) (*big.Int, error) {
 	var result *big.Int
-	err = boundContract.Call(nil, &[]interface{}{&result}, "basefee_global")
-	expectedErrorMsg := "invalid opcode: BASEFEE"
-	if err == nil {
-		return fmt.Errorf("expected %s but got `no error` instead", expectedErrorMsg)
+	err := storageContract.Call(&bind.CallOpts{BlockNumber: blockNr}, &[]interface{}{&result}, "stored_basefee")
+	if err != nil {
+		return nil, err
 	}
-	if err.Error() != expectedErrorMsg {
-		return fmt.Errorf("Expected %s, got %s", expectedErrorMsg, err.Error())
+	return result, nil
+}
+
+// Returns the calldata of the caller contract: the mode followed by the target or salt
+func callerInput(mode int64, arg common.Hash) []byte {
+	return append(common.BigToHash(big.NewInt(mode)).Bytes(), arg.Bytes()...)
+}
+
+// Argument of the caller contract for a mode: the BaseFee contract for the calls, a
+// salt for CREATE2
+func callerArg(mode int64, baseFeeAddress common.Address, salt common.Hash) common.Hash {
+	if mode == callerModeCreate2 {
+		return salt
+	}
+	return common.BytesToHash(baseFeeAddress.Bytes())
+}
+
+// Sends a legacy transaction to the caller contract and returns its hash
+func sendCallerTx(callerAddress common.Address, input []byte) (common.Hash, error) {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      300_000,
+		To:       &callerAddress,
+		Value:    big.NewInt(0),
+		Data:     input,
+	})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return signedTx.Hash(), nil
+}
+
+// Checks that every 32 byte word of a result is the base fee
+func checkBaseFeeWords(context string, result []byte, baseFee *big.Int) error {
+	if len(result) == 0 || len(result)%32 != 0 {
+		return fmt.Errorf("%s returned %d bytes, expected 32 byte words", context, len(result))
+	}
+	for i := 0; i < len(result); i += 32 {
+		if word := new(big.Int).SetBytes(result[i : i+32]); word.Cmp(baseFee) != 0 {
+			return fmt.Errorf("%s returned %v in word %d, expected the base fee %v", context, word, i/32, baseFee)
+		}
+	}
+	return nil
+}
+
+// Checks that a failed transaction consumed all its gas, or at least all but the 1/64
+// that the caller keeps when the failure happens in a nested context
+func checkAllGasConsumed(receipt *types.Receipt, nested bool) error {
+	tx, _, err := client.TransactionByHash(context.Background(), receipt.TxHash)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 0 {
+		return fmt.Errorf("expected transaction %v to fail. Receipt: %+v", receipt.TxHash, receipt)
+	}
+	if !nested && receipt.GasUsed != tx.Gas() {
+		return fmt.Errorf("failed transaction %v used %d gas, expected all of its %d gas", receipt.TxHash, receipt.GasUsed, tx.Gas())
+	}
+	if nested && tx.Gas()-receipt.GasUsed > tx.Gas()/64 {
+		return fmt.Errorf("failed transaction %v used %d gas, expected at least 63/64 of its %d gas", receipt.TxHash, receipt.GasUsed, tx.Gas())
 	}
 	return nil
 }
 
+// Calls eth_call at a block with the given code placed at overrideAddress
+func callWithCodeOverride(blockNr *big.Int, code []byte, data []byte) ([]byte, error) {
+	callArgs := map[string]interface{}{
+		"from": senderAddress,
+		"to":   overrideAddress,
+		"data": hexutil.Bytes(data),
+	}
+	overrides := map[common.Address]map[string]interface{}{
+		overrideAddress: {"code": hexutil.Bytes(code)},
+	}
+	var result hexutil.Bytes
+	err := rpcClient.CallContext(context.Background(), &result, "eth_call", callArgs, hexutil.EncodeBig(blockNr), overrides)
+	return result, err
+}
+
+func testBaseFeeGlobalPreHertz(boundContract *bind.BoundContract) error {
+	var result *big.Int
+	err = boundContract.Call(nil, &[]interface{}{&result}, "basefee_global")
+	return invalidBaseFeeOpcode.Match(err)
+}
+
 func testBaseFeeAssemblyPreHertz(boundContract *bind.BoundContract) error {
 	var result *big.Int
 	err = boundContract.Call(nil, &[]interface{}{&result}, "basefee_inline_assembly")
-	expectedErrorMsg := "invalid opcode: BASEFEE"
-	if err == nil {
-		return fmt.Errorf("Expected %s, got <nil>", expectedErrorMsg)
+	return invalidBaseFeeOpcode.Match(err)
+}
+
+// BASEFEE executed in a mined transaction before Hertz is an invalid opcode, so the
+// transaction fails, consumes all its gas and leaves no event and no stored value
+func testStoreBaseFeePreHertz(storageContract *bind.BoundContract, storageAddress common.Address) error {
+	txHash, err := sendStoreBaseFeeTx(storageAddress, types.LegacyTxType)
+	if err != nil {
+		return err
 	}
-	if err.Error() != expectedErrorMsg {
-		return fmt.Errorf("Expected %s, got %s", expectedErrorMsg, err.Error())
+	receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+	if err != nil {
+		return err
+	}
+	if receipt.BlockNumber.Uint64() >= config.HertzBlockNumber {
+		return fmt.Errorf("store_basefee() transaction was mined in block %v, after Hertz hard fork block %v", receipt.BlockNumber, config.HertzBlockNumber)
+	}
+	if receipt.Status != 0 {
+		return fmt.Errorf("expected store_basefee() to fail before Hertz. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return err
+	}
+	tx, _, err := client.TransactionByHash(context.Background(), txHash)
+	if err != nil {
+		return err
+	}
+	if receipt.GasUsed != tx.Gas() {
+		return fmt.Errorf("failed store_basefee() used %d gas, expected all of its %d gas", receipt.GasUsed, tx.Gas())
+	}
+	if len(receipt.Logs) != 0 {
+		return fmt.Errorf("failed store_basefee() emitted %d events", len(receipt.Logs))
+	}
+	stored, err := storedBaseFeeAt(storageContract, receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	if stored.Cmp(abi.MaxUint256) != 0 {
+		return fmt.Errorf("stored_basefee() is %v after the failed store_basefee(), expected it unchanged", stored)
+	}
+
+	// Replaying the call at the same block has to give the reason of the failure
+	data, err := baseFeeStorageABI.Pack("store_basefee")
+	if err != nil {
+		return err
+	}
+	_, err = client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, To: &storageAddress, Data: data}, receipt.BlockNumber)
+	return invalidBaseFeeOpcode.Match(err)
+}
+
+// BASEFEE in a constructor and in STATICCALL, DELEGATECALL and CREATE2 contexts is an
+// invalid opcode before Hertz. All the transactions are sent at once to be mined
+// before the fork.
+func testBaseFeeNestedContextsPreHertz(baseFeeAddress common.Address) error {
+	childTxHash, childAddress, err := deployContract(baseFeeChildBytecode)
+	if err != nil {
+		return err
+	}
+	callerTxHash, callerAddress, err := deployContract(baseFeeCallerBytecode)
+	if err != nil {
+		return err
+	}
+	txHashes := make([]common.Hash, len(callerModes))
+	for i, mode := range callerModes {
+		txHashes[i], err = sendCallerTx(callerAddress, callerInput(mode, callerArg(mode, baseFeeAddress, common.BigToHash(big.NewInt(int64(i))))))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Constructor
+	receipt, err := utils.WaitForTransactionReceipt(client, childTxHash)
+	if err != nil {
+		return err
+	}
+	if receipt.BlockNumber.Uint64() >= config.HertzBlockNumber {
+		return fmt.Errorf("constructor transaction was mined in block %v, after Hertz hard fork block %v", receipt.BlockNumber, config.HertzBlockNumber)
+	}
+	err = checkAllGasConsumed(receipt, false)
+	if err != nil {
+		return fmt.Errorf("constructor: %v", err)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return fmt.Errorf("constructor: %v", err)
+	}
+	code, err := client.CodeAt(context.Background(), childAddress, receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	if len(code) != 0 {
+		return fmt.Errorf("constructor executing BASEFEE deployed %d bytes of code before Hertz", len(code))
+	}
+	_, err = client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, Data: baseFeeChildBytecode}, receipt.BlockNumber)
+	err = invalidBaseFeeOpcode.Match(err)
+	if err != nil {
+		return fmt.Errorf("constructor: %v", err)
+	}
+
+	// Nested contexts
+	receipt, err = utils.WaitForTransactionReceipt(client, callerTxHash)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return fmt.Errorf("caller deployment failed. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return fmt.Errorf("caller deployment: %v", err)
+	}
+	for i, txHash := range txHashes {
+		receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+		if err != nil {
+			return err
+		}
+		if receipt.BlockNumber.Uint64() >= config.HertzBlockNumber {
+			return fmt.Errorf("mode %d transaction was mined in block %v, after Hertz hard fork block %v", callerModes[i], receipt.BlockNumber, config.HertzBlockNumber)
+		}
+		err = checkAllGasConsumed(receipt, true)
+		if err != nil {
+			return fmt.Errorf("mode %d: %v", callerModes[i], err)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return fmt.Errorf("mode %d: %v", callerModes[i], err)
+		}
+		if len(receipt.Logs) != 0 {
+			return fmt.Errorf("mode %d: failed transaction emitted %d events", callerModes[i], len(receipt.Logs))
+		}
+		input := callerInput(callerModes[i], callerArg(callerModes[i], baseFeeAddress, callSalt))
+		_, err = client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, To: &callerAddress, Data: input}, receipt.BlockNumber)
+		err = nestedFailure.Match(err)
+		if err != nil {
+			return fmt.Errorf("mode %d: %v", callerModes[i], err)
+		}
+	}
+	return nil
+}
+
+// Call-only checks of the pre-Hertz behaviour. They execute eth_call against
+// PreHertzBlockNumber, so they can run at any time on a node that still has the state
+// of that block, e.g. an archive node.
+func testBaseFeeHistoricalCallsPreHertz() error {
+	blockNr := new(big.Int).SetUint64(config.PreHertzBlockNumber)
+
+	// The contract may not exist at that block, so its runtime code is put in place
+	// with a state override. The init code doesn't execute BASEFEE, so it can be run
+	// at the latest block to get the runtime code.
+	runtimeCode, err := client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, Data: common.FromHex(baseFeeContract.Bin)}, nil)
+	if err != nil {
+		return err
+	}
+	for _, method := range []string{"basefee_global", "basefee_inline_assembly"} {
+		data, err := baseFeeContract.ABI.Pack(method)
+		if err != nil {
+			return err
+		}
+		_, err = callWithCodeOverride(blockNr, runtimeCode, data)
+		err = invalidBaseFeeOpcode.Match(err)
+		if err != nil {
+			return fmt.Errorf("%s() at block %v: %v", method, blockNr, err)
+		}
+	}
+
+	_, err = client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, Data: baseFeeChildBytecode}, blockNr)
+	err = invalidBaseFeeOpcode.Match(err)
+	if err != nil {
+		return fmt.Errorf("constructor at block %v: %v", blockNr, err)
 	}
 	return nil
 }
 
 func runPreHertzTests() error {
-	txHash, contractAddress, err := deployBaseFeeContract()
+	txHash, contractAddress, err := deployAndVerifyContract(common.FromHex(baseFeeContract.Bin))
 	if err != nil {
 		return err
 	}
 	log.Printf("BaseFee contract deployed at address = %v . txHash = %v\n", contractAddress, txHash)
 	boundContract := bind.NewBoundContract(contractAddress, baseFeeContract.ABI, client, client, client)
+	txHash, storageAddress, err := deployAndVerifyContract(baseFeeStorageBytecode)
+	if err != nil {
+		return err
+	}
+	log.Printf("BaseFee storage contract deployed at address = %v . txHash = %v\n", storageAddress, txHash)
+	storageContract := bind.NewBoundContract(storageAddress, baseFeeStorageABI, client, client, client)
 	// Test basefee_global()
 	err = testBaseFeeGlobalPreHertz(boundContract)
 	if err != nil {
@@ -190,6 +561,21 @@ func runPreHertzTests() error {
 	if err != nil {
 		return err
 	}
+	// Test store_basefee()
+	err = testStoreBaseFeePreHertz(storageContract, storageAddress)
+	if err != nil {
+		return err
+	}
+	// Test BASEFEE in a constructor and nested contexts
+	err = testBaseFeeNestedContextsPreHertz(contractAddress)
+	if err != nil {
+		return err
+	}
+	// Test the historical eth_calls
+	err = testBaseFeeHistoricalCallsPreHertz()
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -217,13 +603,205 @@ func testBaseFeeGlobalPostHertz(boundContract *bind.BoundContract) error {
 	return nil
 }
 
+// store_basefee() executes BASEFEE in a mined transaction, so the stored value and the
+// event have to be the base fee of the including block for every transaction type
+func testStoreBaseFeePostHertz(storageContract *bind.BoundContract, storageAddress common.Address) error {
+	event := baseFeeStorageABI.Events["BaseFeeStored"]
+	for _, txType := range []uint8{types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType} {
+		txHash, err := sendStoreBaseFeeTx(storageAddress, txType)
+		if err != nil {
+			return err
+		}
+		receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+		if err != nil {
+			return err
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return err
+		}
+		header, err := client.HeaderByNumber(context.Background(), receipt.BlockNumber)
+		if err != nil {
+			return err
+		}
+		if header.BaseFee == nil {
+			return fmt.Errorf("post-Hertz block %v has no base fee", receipt.BlockNumber)
+		}
+
+		if len(receipt.Logs) != 1 {
+			return fmt.Errorf("store_basefee() in a transaction of type %d emitted %d events, expected 1", txType, len(receipt.Logs))
+		}
+		vLog := receipt.Logs[0]
+		if vLog.Address != storageAddress || len(vLog.Topics) != 1 || vLog.Topics[0] != event.ID {
+			return fmt.Errorf("store_basefee() in a transaction of type %d emitted an unexpected event: %+v", txType, vLog)
+		}
+		values, err := event.Inputs.Unpack(vLog.Data)
+		if err != nil {
+			return err
+		}
+		if emitted := values[0].(*big.Int); emitted.Cmp(header.BaseFee) != 0 {
+			return fmt.Errorf("BaseFeeStored event of a transaction of type %d has %v, expected the base fee %v of block %v", txType, emitted, header.BaseFee, receipt.BlockNumber)
+		}
+
+		stored, err := storedBaseFeeAt(storageContract, receipt.BlockNumber)
+		if err != nil {
+			return err
+		}
+		if stored.Cmp(header.BaseFee) != 0 {
+			return fmt.Errorf("stored_basefee() after a transaction of type %d is %v, expected the base fee %v of block %v", txType, stored, header.BaseFee, receipt.BlockNumber)
+		}
+		log.Printf("store_basefee() in a transaction of type %d stored %v in block %v\n", txType, stored, receipt.BlockNumber)
+	}
+	return nil
+}
+
+// BASEFEE in a constructor and in STATICCALL, DELEGATECALL and CREATE2 contexts has to
+// give the base fee of the block, both in eth_call and in mined transactions
+func testBaseFeeNestedContextsPostHertz(baseFeeAddress common.Address) error {
+	childTxHash, childAddress, err := deployContract(baseFeeChildBytecode)
+	if err != nil {
+		return err
+	}
+	callerTxHash, callerAddress, err := deployContract(baseFeeCallerBytecode)
+	if err != nil {
+		return err
+	}
+
+	// Constructor
+	receipt, err := utils.WaitForTransactionReceipt(client, childTxHash)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return fmt.Errorf("constructor: %v", err)
+	}
+	header, err := client.HeaderByNumber(context.Background(), receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	if len(receipt.Logs) != 1 {
+		return fmt.Errorf("constructor emitted %d events, expected 1", len(receipt.Logs))
+	}
+	err = checkBaseFeeWords("constructor event", receipt.Logs[0].Data, header.BaseFee)
+	if err != nil {
+		return err
+	}
+	stored, err := client.StorageAt(context.Background(), childAddress, common.Hash{}, receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	err = checkBaseFeeWords("constructor storage", stored, header.BaseFee)
+	if err != nil {
+		return err
+	}
+	result, err := client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, To: &childAddress}, receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	err = checkBaseFeeWords("child contract", result, header.BaseFee)
+	if err != nil {
+		return err
+	}
+
+	receipt, err = utils.WaitForTransactionReceipt(client, callerTxHash)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return fmt.Errorf("caller deployment failed. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return fmt.Errorf("caller deployment: %v", err)
+	}
+
+	// Nested contexts in eth_call
+	header, err = client.HeaderByNumber(context.Background(), receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	for _, mode := range callerModes {
+		input := callerInput(mode, callerArg(mode, baseFeeAddress, callSalt))
+		result, err := client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, To: &callerAddress, Data: input}, header.Number)
+		if err != nil {
+			return fmt.Errorf("mode %d: %v", mode, err)
+		}
+		err = checkBaseFeeWords(fmt.Sprintf("eth_call in mode %d", mode), result, header.BaseFee)
+		if err != nil {
+			return err
+		}
+	}
+
+	// BASEFEE as revert data of eth_call
+	_, err = client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, Data: baseFeeRevertBytecode}, header.Number)
+	err = utils.RevertError(common.BigToHash(header.BaseFee).Bytes()).Match(err)
+	if err != nil {
+		return fmt.Errorf("reverting constructor at block %v: %v", header.Number, err)
+	}
+
+	// Nested contexts in mined transactions
+	txHashes := make([]common.Hash, len(callerModes))
+	for i, mode := range callerModes {
+		txHashes[i], err = sendCallerTx(callerAddress, callerInput(mode, callerArg(mode, baseFeeAddress, common.BigToHash(big.NewInt(int64(i))))))
+		if err != nil {
+			return err
+		}
+	}
+	for i, txHash := range txHashes {
+		receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+		if err != nil {
+			return err
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("mode %d: receipt.Status != 1. Receipt: %+v", callerModes[i], receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return fmt.Errorf("mode %d: %v", callerModes[i], err)
+		}
+		header, err := client.HeaderByNumber(context.Background(), receipt.BlockNumber)
+		if err != nil {
+			return err
+		}
+		var callerLogs int
+		for _, vLog := range receipt.Logs {
+			// The CREATE2 child emits its constructor event too
+			err = checkBaseFeeWords(fmt.Sprintf("event of %v in mode %d", vLog.Address, callerModes[i]), vLog.Data, header.BaseFee)
+			if err != nil {
+				return err
+			}
+			if vLog.Address == callerAddress {
+				callerLogs++
+			}
+		}
+		if callerLogs != 1 {
+			return fmt.Errorf("mode %d: caller emitted %d events, expected 1", callerModes[i], callerLogs)
+		}
+		log.Printf("BASEFEE in mode %d returned %v in block %v\n", callerModes[i], header.BaseFee, receipt.BlockNumber)
+	}
+	return nil
+}
+
 func runPostHertzTests() error {
-	txHash, contractAddress, err := deployBaseFeeContract()
+	txHash, contractAddress, err := deployAndVerifyContract(common.FromHex(baseFeeContract.Bin))
 	if err != nil {
 		return err
 	}
 	log.Printf("BaseFee contract deployed at address = %v . txHash = %v\n", contractAddress, txHash)
 	boundContract := bind.NewBoundContract(contractAddress, baseFeeContract.ABI, client, client, client)
+	txHash, storageAddress, err := deployAndVerifyContract(baseFeeStorageBytecode)
+	if err != nil {
+		return err
+	}
+	log.Printf("BaseFee storage contract deployed at address = %v . txHash = %v\n", storageAddress, txHash)
+	storageContract := bind.NewBoundContract(storageAddress, baseFeeStorageABI, client, client, client)
 	// Test basefee_global()
 	err = testBaseFeeGlobalPostHertz(boundContract)
 	if err != nil {
@@ -234,6 +812,16 @@ func runPostHertzTests() error {
 	if err != nil {
 		return err
 	}
+	// Tests store_basefee()
+	err = testStoreBaseFeePostHertz(storageContract, storageAddress)
+	if err != nil {
+		return err
+	}
+	// Tests BASEFEE in a constructor and nested contexts
+	err = testBaseFeeNestedContextsPostHertz(contractAddress)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -244,7 +832,13 @@ func preHertzTests() {
 		log.Fatal(err)
 	}
 	if blockNr >= config.PostHertzBlockNumber {
-		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+		log.Printf("Too late to send pre-Hertz transactions since current block number %v is after Hertz hard fork block %v. Running the historical eth_call tests at block %v only.\n", blockNr, config.PostHertzBlockNumber, config.PreHertzBlockNumber)
+		err = testBaseFeeHistoricalCallsPreHertz()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("All Pre-Hertz eth_call tests passed! The Pre-Hertz transaction cases were skipped.")
+		return
 	}
 	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
 	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
@@ -256,6 +850,7 @@ func preHertzTests() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	log.Println("All Pre-Hertz tests passed!")
 }
 
 func postHertzTests() {
@@ -269,6 +864,7 @@ func postHertzTests() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	log.Println("All Post-Hertz tests passed!")
 }
 
 func main() {
@@ -7,42 +7,81 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 	"sync"
 
 	"hertzTests/config"
 	"hertzTests/utils"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var senderPrivateKey *ecdsa.PrivateKey
 var senderAddress common.Address
+var rpcClient *rpc.Client
 var client *ethclient.Client
 var err error
 
 // The simplest bytecode that results in runtime bytecode of 0xef
 var bytecodeDeploying0xEF = common.FromHex("0x60ef60005360016000f3")
 
+// Init code of a factory contract. The first calldata word selects CREATE (1) or
+// CREATE2 (2), the second word is the CREATE2 salt and the rest of the calldata is the
+// init code to deploy, with the value of the call forwarded to the new contract. The
+// factory emits the address returned by CREATE or CREATE2 as the data of a LOG0 and
+// returns it, also when it is the zero address of a failed deployment.
+var factoryBytecode = common.FromHex("0x603380600b6000396000f36040360380604060003760003560021461001c57600034f0610025565b60203590600034f55b60005260206000a060206000f3")
+
+// Value sent with the deployments whose side effects are checked
+var deploymentValue = big.NewInt(1000)
+
+const (
+	factoryModeCreate  = 1
+	factoryModeCreate2 = 2
+)
+
+// Runtime code deployed through the factory. EIP-3541 rejects code starting with 0xEF,
+// 0xEF in any other position is allowed.
+type DeployedCodeCase struct {
+	name     string
+	code     []byte
+	rejected bool // whether the deployment fails after Hertz
+}
+
+var deployedCodeCases = []DeployedCodeCase{
+	{name: "0xEF", code: common.FromHex("0xef"), rejected: true},
+	{name: "0xEF00", code: common.FromHex("0xef00"), rejected: true},
+	{name: "0xEF0001", code: common.FromHex("0xef0001"), rejected: true},
+	{name: "0xEF followed by 31 bytes", code: common.FromHex("0xef" + strings.Repeat("00", 31)), rejected: true},
+	{name: "0x00EF", code: common.FromHex("0x00ef"), rejected: false},
+	{name: "PUSH1 0xEF", code: common.FromHex("0x60ef"), rejected: false},
+	{name: "0xFE 0xEF", code: common.FromHex("0xfeef"), rejected: false},
+}
+
 func init() {
 	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Connect to an Ethereum client
-	client, err = ethclient.Dial("http://localhost:8545")
+	// Connect to an Ethereum client. The raw RPC client is needed for the fee
+	// accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
 	if err != nil {
 		log.Fatal(err)
 	}
+	client = ethclient.NewClient(rpcClient)
 
 	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
 }
 
 // Deploy contract with given bytecode. Returns (txHash, contractAddress, error)
-func deployContract(bytecode []byte) (common.Hash, common.Address, error) {
+func deployContract(bytecode []byte, gas uint64, value *big.Int) (common.Hash, common.Address, error) {
 	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
 	if err != nil {
 		return common.Hash{}, common.Address{}, err
@@ -56,8 +95,8 @@ func deployContract(bytecode []byte) (common.Hash, common.Address, error) {
 	tx := types.NewTx(&types.LegacyTx{
 		Nonce:    nonce,
 		GasPrice: gasPrice,
-		Gas:      60_000,
-		Value:    big.NewInt(0),
+		Gas:      gas,
+		Value:    value,
 		Data:     bytecode,
 	})
 	signer := types.NewEIP155Signer(config.ChainId)
@@ -74,8 +113,248 @@ func deployContract(bytecode []byte) (common.Hash, common.Address, error) {
 	return signedTx.Hash(), contractAddress, nil
 }
 
+// Checks that there is no code, nonce or balance at an address
+func verifyEmptyAccount(address common.Address, blockNr *big.Int) error {
+	code, err := client.CodeAt(context.Background(), address, blockNr)
+	if err != nil {
+		return err
+	}
+	if len(code) != 0 {
+		return fmt.Errorf("code %v exists at %v", common.Bytes2Hex(code), address)
+	}
+	nonce, err := client.NonceAt(context.Background(), address, blockNr)
+	if err != nil {
+		return err
+	}
+	if nonce != 0 {
+		return fmt.Errorf("nonce of %v is %d, expected 0", address, nonce)
+	}
+	balance, err := client.BalanceAt(context.Background(), address, blockNr)
+	if err != nil {
+		return err
+	}
+	if balance.Sign() != 0 {
+		return fmt.Errorf("balance of %v is %v, expected 0", address, balance)
+	}
+	return nil
+}
+
+// Returns init code that deploys the given runtime code:
+// PUSH1 len DUP1 PUSH1 0x0b PUSH1 0x00 CODECOPY PUSH1 0x00 RETURN <code>
+func initCodeReturning(code []byte) []byte {
+	return append([]byte{0x60, byte(len(code)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}, code...)
+}
+
+// Sends a transaction making the factory deploy initCode. Returns the transaction hash.
+func sendFactoryTx(factoryAddress common.Address, mode int64, salt common.Hash, initCode []byte, value *big.Int) (common.Hash, error) {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return common.Hash{}, err
+	}
+	data := append(common.BigToHash(big.NewInt(mode)).Bytes(), salt.Bytes()...)
+	data = append(data, initCode...)
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      200_000,
+		To:       &factoryAddress,
+		Value:    value,
+		Data:     data,
+	})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return signedTx.Hash(), nil
+}
+
+// A deployment made through the factory
+type factoryDeployment struct {
+	codeCase        DeployedCodeCase
+	mode            int64
+	expectedAddress common.Address // the address of the new contract if the deployment succeeds
+	txHash          common.Hash
+}
+
+// Deploys the factory and sends one transaction per code case and per CREATE and
+// CREATE2 at once, so that they are mined in a few blocks
+func sendFactoryDeployments(value *big.Int) (common.Address, []factoryDeployment, error) {
+	txHash, factoryAddress, err := deployContract(factoryBytecode, 100_000, big.NewInt(0))
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	var deployments []factoryDeployment
+	for _, codeCase := range deployedCodeCases {
+		for _, mode := range []int64{factoryModeCreate, factoryModeCreate2} {
+			initCode := initCodeReturning(codeCase.code)
+			// A contract starts with nonce 1 and both CREATE and CREATE2 increment it,
+			// also when the deployment fails
+			factoryNonce := uint64(len(deployments) + 1)
+			salt := common.BigToHash(big.NewInt(int64(len(deployments))))
+			deployment := factoryDeployment{codeCase: codeCase, mode: mode}
+			if mode == factoryModeCreate {
+				deployment.expectedAddress = crypto.CreateAddress(factoryAddress, factoryNonce)
+			} else {
+				deployment.expectedAddress = crypto.CreateAddress2(factoryAddress, salt, crypto.Keccak256(initCode))
+			}
+			deployment.txHash, err = sendFactoryTx(factoryAddress, mode, salt, initCode, value)
+			if err != nil {
+				return common.Address{}, nil, err
+			}
+			deployments = append(deployments, deployment)
+		}
+	}
+
+	receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if receipt.Status != 1 {
+		return common.Address{}, nil, fmt.Errorf("factory deployment failed. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return factoryAddress, deployments, nil
+}
+
+// Checks the outcome of a factory deployment: the factory call succeeds and observes
+// either the new contract with the expected code and the value, or the zero address if
+// the deployment is rejected. A rejected deployment consumes all the gas given to
+// CREATE or CREATE2, which leaves the factory call at most 1/64 of its gas, and leaves
+// nothing at the would-be address.
+func verifyFactoryDeployment(factoryAddress common.Address, deployment factoryDeployment, rejected bool, value *big.Int) (*types.Receipt, error) {
+	name := fmt.Sprintf("%s with mode %d", deployment.codeCase.name, deployment.mode)
+	receipt, err := utils.WaitForTransactionReceipt(client, deployment.txHash)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != 1 {
+		return nil, fmt.Errorf("%s: factory call failed. Receipt: %+v", name, receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	var observed []common.Address
+	for _, vLog := range receipt.Logs {
+		if vLog.Address == factoryAddress {
+			observed = append(observed, common.BytesToAddress(vLog.Data))
+		}
+	}
+	if len(observed) != 1 {
+		return nil, fmt.Errorf("%s: factory emitted %d events, expected 1", name, len(observed))
+	}
+
+	if rejected {
+		if observed[0] != (common.Address{}) {
+			return nil, fmt.Errorf("%s: factory observed address %v, expected the zero address", name, observed[0])
+		}
+		tx, _, err := client.TransactionByHash(context.Background(), deployment.txHash)
+		if err != nil {
+			return nil, err
+		}
+		if tx.Gas()-receipt.GasUsed > tx.Gas()/64 {
+			return nil, fmt.Errorf("%s: factory call used %d of %d gas, expected the rejected deployment to consume all the gas given to it", name, receipt.GasUsed, tx.Gas())
+		}
+		err = verifyEmptyAccount(deployment.expectedAddress, receipt.BlockNumber)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return receipt, nil
+	}
+	if observed[0] != deployment.expectedAddress {
+		return nil, fmt.Errorf("%s: factory observed address %v, expected %v", name, observed[0], deployment.expectedAddress)
+	}
+	code, err := client.CodeAt(context.Background(), deployment.expectedAddress, receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(code, deployment.codeCase.code) {
+		return nil, fmt.Errorf("%s: deployed code is %v, expected %v", name, common.Bytes2Hex(code), common.Bytes2Hex(deployment.codeCase.code))
+	}
+	balance, err := client.BalanceAt(context.Background(), deployment.expectedAddress, receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if balance.Cmp(value) != 0 {
+		return nil, fmt.Errorf("%s: balance of the new contract is %v, expected %v", name, balance, value)
+	}
+	return receipt, nil
+}
+
+// Checks that the factory kept the value of the rejected deployments, and that its
+// nonce was advanced by every CREATE and CREATE2, after the last deployment was mined
+func verifyFactoryState(factoryAddress common.Address, deployments []factoryDeployment, lastBlock *big.Int, rejectedCount int, value *big.Int) error {
+	nonce, err := client.NonceAt(context.Background(), factoryAddress, lastBlock)
+	if err != nil {
+		return err
+	}
+	if expected := uint64(len(deployments) + 1); nonce != expected {
+		return fmt.Errorf("factory nonce is %d, expected %d", nonce, expected)
+	}
+	balance, err := client.BalanceAt(context.Background(), factoryAddress, lastBlock)
+	if err != nil {
+		return err
+	}
+	if expected := new(big.Int).Mul(value, big.NewInt(int64(rejectedCount))); balance.Cmp(expected) != 0 {
+		return fmt.Errorf("factory balance is %v, expected the %v value of %d rejected deployments", balance, expected, rejectedCount)
+	}
+	return nil
+}
+
+// Before Hertz every code can be deployed through CREATE and CREATE2
+func testFactoryDeploymentsPreHertz() error {
+	factoryAddress, deployments, err := sendFactoryDeployments(deploymentValue)
+	if err != nil {
+		return err
+	}
+	var lastBlock *big.Int
+	for _, deployment := range deployments {
+		receipt, err := verifyFactoryDeployment(factoryAddress, deployment, false, deploymentValue)
+		if err != nil {
+			return err
+		}
+		if receipt.BlockNumber.Uint64() >= config.HertzBlockNumber {
+			return fmt.Errorf("factory deployment was mined in block %v, after Hertz hard fork block %v", receipt.BlockNumber, config.HertzBlockNumber)
+		}
+		lastBlock = receipt.BlockNumber
+	}
+	return verifyFactoryState(factoryAddress, deployments, lastBlock, 0, deploymentValue)
+}
+
+// After Hertz CREATE and CREATE2 fail only for code starting with 0xEF
+func testFactoryDeploymentsPostHertz() error {
+	factoryAddress, deployments, err := sendFactoryDeployments(deploymentValue)
+	if err != nil {
+		return err
+	}
+	var lastBlock *big.Int
+	rejectedCount := 0
+	for _, deployment := range deployments {
+		receipt, err := verifyFactoryDeployment(factoryAddress, deployment, deployment.codeCase.rejected, deploymentValue)
+		if err != nil {
+			return err
+		}
+		if deployment.codeCase.rejected {
+			rejectedCount++
+		}
+		lastBlock = receipt.BlockNumber
+	}
+	return verifyFactoryState(factoryAddress, deployments, lastBlock, rejectedCount, deploymentValue)
+}
+
 func test0xEFDDeploymentPreHertz() error {
-	txHash, contractAddress, err := deployContract(bytecodeDeploying0xEF)
+	txHash, contractAddress, err := deployContract(bytecodeDeploying0xEF, 60_000, big.NewInt(0))
 	if err != nil {
 		return err
 	}
@@ -87,6 +366,10 @@ func test0xEFDDeploymentPreHertz() error {
 	if receipt.Status != 1 {
 		return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
 	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return err
+	}
 
 	// Check that the contract code at the deployed contract address is 0xEF
 	blockNr := receipt.BlockNumber
@@ -100,8 +383,26 @@ func test0xEFDDeploymentPreHertz() error {
 	return nil
 }
 
+// Call-only check of the pre-Hertz behaviour. It executes eth_call against
+// PreHertzBlockNumber, so it can run at any time on a node that still has the state
+// of that block, e.g. an archive node.
+func test0xEFHistoricalCallPreHertz() error {
+	blockNr := new(big.Int).SetUint64(config.PreHertzBlockNumber)
+	result, err := client.CallContract(context.Background(), ethereum.CallMsg{From: senderAddress, Data: bytecodeDeploying0xEF}, blockNr)
+	if err != nil {
+		return fmt.Errorf("eth_call deploying 0xef at block %v failed: %v", blockNr, err)
+	}
+	if !bytes.Equal(result, common.FromHex("0xef")) {
+		return fmt.Errorf("eth_call deploying 0xef at block %v returned %v, expected 0xef", blockNr, common.Bytes2Hex(result))
+	}
+	return nil
+}
+
+// Besides failing, the rejected deployment has to consume all the gas, advance the
+// nonce of the sender, leave no code, nonce or balance at the would-be contract
+// address and return the value to the sender
 func test0xEFDeploymentPostHertz() error {
-	txHash, _, err := deployContract(bytecodeDeploying0xEF)
+	txHash, contractAddress, err := deployContract(bytecodeDeploying0xEF, 60_000, deploymentValue)
 	if err != nil {
 		return err
 	}
@@ -113,7 +414,26 @@ func test0xEFDeploymentPostHertz() error {
 	if receipt.Status != 0 {
 		return fmt.Errorf("receipt.Status != 0. Receipt: %+v", receipt)
 	}
-	return nil
+	tx, _, err := client.TransactionByHash(context.Background(), txHash)
+	if err != nil {
+		return err
+	}
+	if receipt.GasUsed != tx.Gas() {
+		return fmt.Errorf("rejected deployment used %d gas, expected all of its %d gas", receipt.GasUsed, tx.Gas())
+	}
+	nonce, err := client.NonceAt(context.Background(), senderAddress, receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	if nonce <= tx.Nonce() {
+		return fmt.Errorf("sender nonce is %d after the rejected deployment with nonce %d", nonce, tx.Nonce())
+	}
+	err = verifyEmptyAccount(contractAddress, receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	// The value is only moved if the transaction succeeds, so the sender has to pay the fees only
+	return utils.VerifyFeeAccounting(rpcClient, txHash)
 }
 
 func preHertzTests() {
@@ -123,7 +443,13 @@ func preHertzTests() {
 		log.Fatal(err)
 	}
 	if blockNr >= config.PostHertzBlockNumber {
-		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+		log.Printf("Too late to send pre-Hertz transactions since current block number %v is after Hertz hard fork block %v. Running the historical eth_call tests at block %v only.\n", blockNr, config.PostHertzBlockNumber, config.PreHertzBlockNumber)
+		err = test0xEFHistoricalCallPreHertz()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("All Pre-Hertz eth_call tests passed! The Pre-Hertz transaction cases were skipped.")
+		return
 	}
 	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
 	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
@@ -135,6 +461,14 @@ func preHertzTests() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = test0xEFHistoricalCallPreHertz()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = testFactoryDeploymentsPreHertz()
+	if err != nil {
+		log.Fatal(err)
+	}
 	log.Println("All Pre-Hertz tests passed!")
 }
 
@@ -150,6 +484,10 @@ func postHertzTests() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = testFactoryDeploymentsPostHertz()
+	if err != nil {
+		log.Fatal(err)
+	}
 	log.Println("All Post-Hertz tests passed!")
 }
 
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// The result of eth_feeHistory
+type feeHistoryResult struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var receiverPrivateKey *ecdsa.PrivateKey
+var receiverAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+var rewardPercentiles = []float64{0, 10, 25, 50, 75, 90, 100}
+
+// Number of transactions with distinct tips to mine in a single block
+var tippedTxsCount = 5
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	receiverPrivateKey, err = crypto.HexToECDSA(config.ReceiverPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. eth_feeHistory is not available in ethclient,
+	// so it is called through the raw RPC client.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
+}
+
+// Calls eth_feeHistory. lastBlock is either a block number or a tag like "latest".
+// Returns the decoded result and the names of the fields present in the response.
+func feeHistory(blockCount uint64, lastBlock string, percentiles []float64) (*feeHistoryResult, map[string]json.RawMessage, error) {
+	var raw json.RawMessage
+	err := rpcClient.CallContext(context.Background(), &raw, "eth_feeHistory", hexutil.EncodeUint64(blockCount), lastBlock, percentiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, nil, err
+	}
+	var result feeHistoryResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, nil, err
+	}
+	return &result, fields, nil
+}
+
+// Computes the reward percentiles of a block the way the gas price oracle does:
+// effective tips sorted in ascending order and weighted by the gas used of each transaction
+func expectedRewards(block *types.Block, percentiles []float64) ([]*big.Int, error) {
+	rewards := make([]*big.Int, len(percentiles))
+	txs := block.Transactions()
+	if len(txs) == 0 {
+		for i := range rewards {
+			rewards[i] = new(big.Int)
+		}
+		return rewards, nil
+	}
+
+	type txGasAndReward struct {
+		gasUsed uint64
+		reward  *big.Int
+	}
+	sorted := make([]txGasAndReward, len(txs))
+	for i, tx := range txs {
+		receipt, err := client.TransactionReceipt(context.Background(), tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		reward, _ := tx.EffectiveGasTip(block.BaseFee())
+		sorted[i] = txGasAndReward{gasUsed: receipt.GasUsed, reward: reward}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].reward.Cmp(sorted[j].reward) < 0
+	})
+
+	txIndex := 0
+	sumGasUsed := sorted[0].gasUsed
+	for i, p := range percentiles {
+		thresholdGasUsed := uint64(float64(block.GasUsed()) * p / 100)
+		for sumGasUsed < thresholdGasUsed && txIndex < len(txs)-1 {
+			txIndex++
+			sumGasUsed += sorted[txIndex].gasUsed
+		}
+		rewards[i] = sorted[txIndex].reward
+	}
+	return rewards, nil
+}
+
+// Checks the shape of a fee history result against the number of blocks it should
+// cover and its values against the blocks themselves. Base fees have to be 0 both
+// before Hertz, where blocks have no base fee, and after it.
+func verifyFeeHistory(result *feeHistoryResult, fields map[string]json.RawMessage, expectedBlocks int, percentiles []float64) error {
+	if result.OldestBlock == nil {
+		return fmt.Errorf("oldestBlock is missing")
+	}
+	if len(result.GasUsedRatio) != expectedBlocks {
+		return fmt.Errorf("gasUsedRatio has %d entries, expected %d", len(result.GasUsedRatio), expectedBlocks)
+	}
+	// baseFeePerGas includes the base fee of the block after the newest one
+	if len(result.BaseFee) != expectedBlocks+1 {
+		return fmt.Errorf("baseFeePerGas has %d entries, expected %d", len(result.BaseFee), expectedBlocks+1)
+	}
+	_, hasReward := fields["reward"]
+	if len(percentiles) == 0 && hasReward {
+		return fmt.Errorf("reward is present although no percentiles were requested")
+	}
+	if len(percentiles) != 0 && len(result.Reward) != expectedBlocks {
+		return fmt.Errorf("reward has %d entries, expected %d", len(result.Reward), expectedBlocks)
+	}
+	for i, baseFee := range result.BaseFee {
+		if baseFee == nil || baseFee.ToInt().Sign() != 0 {
+			return fmt.Errorf("baseFeePerGas[%d] of block %v is %v, expected 0", i, new(big.Int).Add(result.OldestBlock.ToInt(), big.NewInt(int64(i))), baseFee)
+		}
+	}
+
+	for i := 0; i < expectedBlocks; i++ {
+		blockNr := new(big.Int).Add(result.OldestBlock.ToInt(), big.NewInt(int64(i)))
+		block, err := client.BlockByNumber(context.Background(), blockNr)
+		if err != nil {
+			return err
+		}
+		gasUsedRatio := float64(block.GasUsed()) / float64(block.GasLimit())
+		if result.GasUsedRatio[i] != gasUsedRatio {
+			return fmt.Errorf("gasUsedRatio of block %v is %v, expected %v", blockNr, result.GasUsedRatio[i], gasUsedRatio)
+		}
+		if len(percentiles) == 0 {
+			continue
+		}
+		if len(result.Reward[i]) != len(percentiles) {
+			return fmt.Errorf("reward of block %v has %d entries, expected %d", blockNr, len(result.Reward[i]), len(percentiles))
+		}
+		rewards, err := expectedRewards(block, percentiles)
+		if err != nil {
+			return err
+		}
+		for j, reward := range rewards {
+			if result.Reward[i][j] == nil || result.Reward[i][j].ToInt().Cmp(reward) != 0 {
+				return fmt.Errorf("reward of block %v at percentile %v is %v, expected %v", blockNr, percentiles[j], result.Reward[i][j], reward)
+			}
+		}
+	}
+	return nil
+}
+
+// Sends DynamicFeeTxs with distinct tips back to back and returns the first and the
+// last block they were mined in
+func sendTippedTxs() (uint64, uint64, error) {
+	baseTip, err := client.SuggestGasTipCap(context.Background())
+	if err != nil {
+		return 0, 0, err
+	}
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return 0, 0, err
+	}
+	txHashes := make([]common.Hash, tippedTxsCount)
+	for i := 0; i < tippedTxsCount; i++ {
+		gasTipCap := new(big.Int).Mul(baseTip, big.NewInt(int64(i+1)))
+		tx := types.NewTx(&types.DynamicFeeTx{
+			ChainID:   config.ChainId,
+			Nonce:     nonce + uint64(i),
+			To:        &receiverAddress,
+			Value:     big.NewInt(1),
+			Gas:       21000,
+			GasFeeCap: new(big.Int).Mul(gasTipCap, big.NewInt(2)),
+			GasTipCap: gasTipCap,
+			Data:      []byte{},
+		})
+		signedTx, err := types.SignTx(tx, types.NewLondonSigner(config.ChainId), senderPrivateKey)
+		if err != nil {
+			return 0, 0, err
+		}
+		err = client.SendTransaction(context.Background(), signedTx)
+		if err != nil {
+			return 0, 0, err
+		}
+		txHashes[i] = signedTx.Hash()
+	}
+
+	var firstBlock, lastBlock uint64
+	for i, txHash := range txHashes {
+		receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+		if err != nil {
+			return 0, 0, err
+		}
+		if receipt.Status != 1 {
+			return 0, 0, fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return 0, 0, err
+		}
+		blockNr := receipt.BlockNumber.Uint64()
+		if i == 0 || blockNr < firstBlock {
+			firstBlock = blockNr
+		}
+		if blockNr > lastBlock {
+			lastBlock = blockNr
+		}
+	}
+	return firstBlock, lastBlock, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// A range from before Hertz to after it, without and with reward percentiles
+func testFeeHistoryAcrossFork() error {
+	lastBlock := config.PostHertzBlockNumber
+	blockCount := int(config.PostHertzBlockNumber - config.PreHertzBlockNumber + 1)
+
+	result, fields, err := feeHistory(uint64(blockCount), hexutil.EncodeUint64(lastBlock), nil)
+	if err != nil {
+		return err
+	}
+	expectedBlocks := minInt(blockCount, config.FeeHistoryMaxHeaderHistory)
+	err = verifyFeeHistory(result, fields, expectedBlocks, nil)
+	if err != nil {
+		return fmt.Errorf("without percentiles: %v", err)
+	}
+
+	result, fields, err = feeHistory(uint64(blockCount), hexutil.EncodeUint64(lastBlock), rewardPercentiles)
+	if err != nil {
+		return err
+	}
+	expectedBlocks = minInt(blockCount, config.FeeHistoryMaxBlockHistory)
+	err = verifyFeeHistory(result, fields, expectedBlocks, rewardPercentiles)
+	if err != nil {
+		return fmt.Errorf("with percentiles: %v", err)
+	}
+	if oldest := result.OldestBlock.ToInt().Uint64(); oldest != lastBlock+1-uint64(expectedBlocks) {
+		return fmt.Errorf("oldestBlock is %d, expected %d", oldest, lastBlock+1-uint64(expectedBlocks))
+	}
+	return nil
+}
+
+// Rewards of the blocks with a mix of tips have to follow the gas weighted
+// percentiles. The range covers every block a tipped transaction was mined in.
+func testFeeHistoryRewardPercentiles() error {
+	firstBlock, lastBlock, err := sendTippedTxs()
+	if err != nil {
+		return err
+	}
+	blockCount := int(lastBlock - firstBlock + 1)
+	if blockCount > config.FeeHistoryMaxBlockHistory {
+		return fmt.Errorf("the tipped transactions were mined in %d blocks, more than the %d blocks eth_feeHistory returns with percentiles", blockCount, config.FeeHistoryMaxBlockHistory)
+	}
+	result, fields, err := feeHistory(uint64(blockCount), hexutil.EncodeUint64(lastBlock), rewardPercentiles)
+	if err != nil {
+		return err
+	}
+	if oldest := result.OldestBlock.ToInt().Uint64(); oldest != firstBlock {
+		return fmt.Errorf("oldestBlock is %d, expected %d", oldest, firstBlock)
+	}
+	return verifyFeeHistory(result, fields, blockCount, rewardPercentiles)
+}
+
+func testFeeHistoryLatest() error {
+	result, fields, err := feeHistory(4, "latest", []float64{50})
+	if err != nil {
+		return err
+	}
+	head, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	newest := result.OldestBlock.ToInt().Uint64() + uint64(len(result.GasUsedRatio)) - 1
+	if newest > head {
+		return fmt.Errorf("newest block of the latest fee history is %d, after the head %d", newest, head)
+	}
+	return verifyFeeHistory(result, fields, 4, []float64{50})
+}
+
+// The pending block is only included if the node can provide it, otherwise the range
+// ends at the latest block and is one block shorter
+func testFeeHistoryPending() error {
+	headBefore, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	result, _, err := feeHistory(4, "pending", []float64{50})
+	if err != nil {
+		return err
+	}
+	blocks := len(result.GasUsedRatio)
+	if blocks != 4 && blocks != 3 {
+		return fmt.Errorf("pending fee history has %d blocks, expected 4 or 3", blocks)
+	}
+	if len(result.BaseFee) != blocks+1 || len(result.Reward) != blocks {
+		return fmt.Errorf("pending fee history has %d base fees and %d rewards for %d blocks", len(result.BaseFee), len(result.Reward), blocks)
+	}
+	newest := result.OldestBlock.ToInt().Uint64() + uint64(blocks) - 1
+	if newest < headBefore {
+		return fmt.Errorf("newest block of the pending fee history is %d, before the head %d", newest, headBefore)
+	}
+	for i, baseFee := range result.BaseFee {
+		if baseFee == nil || baseFee.ToInt().Sign() != 0 {
+			return fmt.Errorf("baseFeePerGas[%d] of the pending fee history is %v, expected 0", i, baseFee)
+		}
+	}
+	return nil
+}
+
+// Block counts above the history limits of the node or above the chain length are truncated
+func testFeeHistoryOverLargeBlockCount() error {
+	head, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	blockCount := uint64(1_000_000)
+
+	result, fields, err := feeHistory(blockCount, hexutil.EncodeUint64(head), nil)
+	if err != nil {
+		return err
+	}
+	expectedBlocks := minInt(int(head)+1, config.FeeHistoryMaxHeaderHistory)
+	err = verifyFeeHistory(result, fields, expectedBlocks, nil)
+	if err != nil {
+		return fmt.Errorf("without percentiles: %v", err)
+	}
+
+	result, fields, err = feeHistory(blockCount, hexutil.EncodeUint64(head), []float64{50})
+	if err != nil {
+		return err
+	}
+	expectedBlocks = minInt(int(head)+1, config.FeeHistoryMaxBlockHistory)
+	return verifyFeeHistory(result, fields, expectedBlocks, []float64{50})
+}
+
+func testFeeHistoryInvalidPercentiles() error {
+	invalidPercentiles := [][]float64{{50, 10}, {-1}, {101}}
+	for _, percentiles := range invalidPercentiles {
+		_, _, err := feeHistory(1, "latest", percentiles)
+		err = utils.ErrorWithPrefix("invalid reward percentile").Match(err)
+		if err != nil {
+			return fmt.Errorf("percentiles %v: %v", percentiles, err)
+		}
+	}
+	return nil
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runFeeHistoryTests() {
+	testCases := []TestCase{
+		{
+			name:               "testFeeHistoryAcrossFork",
+			validationFunction: testFeeHistoryAcrossFork,
+		},
+		{
+			name:               "testFeeHistoryRewardPercentiles",
+			validationFunction: testFeeHistoryRewardPercentiles,
+		},
+		{
+			name:               "testFeeHistoryLatest",
+			validationFunction: testFeeHistoryLatest,
+		},
+		{
+			name:               "testFeeHistoryPending",
+			validationFunction: testFeeHistoryPending,
+		},
+		{
+			name:               "testFeeHistoryOverLargeBlockCount",
+			validationFunction: testFeeHistoryOverLargeBlockCount,
+		},
+		{
+			name:               "testFeeHistoryInvalidPercentiles",
+			validationFunction: testFeeHistoryInvalidPercentiles,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+// Fee history is built from past blocks, so the cases covering pre-Hertz blocks
+// can run at any time after the post-Hertz block
+func main() {
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runFeeHistoryTests()
+	fmt.Println("ALL TESTS PASSED!")
+}
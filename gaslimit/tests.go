@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+// Init code of a contract that burns all the gas it is given except for ~5000:
+// runtime code: JUMPDEST PUSH2 0x1388 GAS GT PUSH1 0x00 JUMPI STOP
+var gasBurnerBytecode = common.FromHex("0x600a600c600039600a6000f35b6113885a1160005700")
+
+// Number of full blocks of load to submit on each side of the fork. The pre-Hertz
+// load has to be mined between PreHertzBlockNumber and HertzBlockNumber.
+var preHertzLoadBlocks = 4
+var postHertzLoadBlocks = 6
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts for the fee accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+}
+
+// Deploys the gas burner contract and returns its address
+func deployGasBurner() (common.Address, error) {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return common.Address{}, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return common.Address{}, err
+	}
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      100_000,
+		Value:    big.NewInt(0),
+		Data:     gasBurnerBytecode,
+	})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return common.Address{}, err
+	}
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	receipt, err := utils.WaitForTransactionReceipt(client, signedTx.Hash())
+	if err != nil {
+		return common.Address{}, err
+	}
+	if receipt.Status != 1 {
+		return common.Address{}, fmt.Errorf("gas burner deployment failed. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.CreateAddress(senderAddress, nonce), nil
+}
+
+// Sends count legacy transactions to the gas burner, each using more than the gas
+// target of the current block. Returns the range of blocks they were mined in.
+func submitLoad(gasBurner common.Address, count int) (uint64, uint64, error) {
+	header, err := client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return 0, 0, err
+	}
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return 0, 0, err
+	}
+	gasLimit := header.GasLimit * 55 / 100
+
+	txHashes := make([]common.Hash, count)
+	for i := 0; i < count; i++ {
+		tx := types.NewTx(&types.LegacyTx{
+			Nonce:    nonce + uint64(i),
+			GasPrice: gasPrice,
+			Gas:      gasLimit,
+			To:       &gasBurner,
+			Value:    big.NewInt(0),
+			Data:     []byte{},
+		})
+		signedTx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+		if err != nil {
+			return 0, 0, err
+		}
+		err = client.SendTransaction(context.Background(), signedTx)
+		if err != nil {
+			return 0, 0, err
+		}
+		txHashes[i] = signedTx.Hash()
+	}
+
+	var firstBlock, lastBlock uint64
+	for i, txHash := range txHashes {
+		receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+		if err != nil {
+			return 0, 0, err
+		}
+		if receipt.Status != 1 {
+			return 0, 0, fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return 0, 0, err
+		}
+		if i == 0 {
+			firstBlock = receipt.BlockNumber.Uint64()
+		}
+		lastBlock = receipt.BlockNumber.Uint64()
+	}
+	log.Printf("Load of %d transactions mined in blocks %d to %d\n", count, firstBlock, lastBlock)
+	return firstBlock, lastBlock, nil
+}
+
+// Checks the gas limit of a block against its parent with Parlia's rules:
+// |gasLimit - parentGasLimit| < parentGasLimit / GasLimitBoundDivisor and gasLimit >= MinGasLimit.
+// Unlike the Ethereum London transition, the parent gas limit is never multiplied by
+// the elasticity multiplier, not even at the fork block.
+func verifyGasLimit(parent, header *types.Header) error {
+	blockNr := header.Number.Uint64()
+	diff := new(big.Int).Sub(new(big.Int).SetUint64(header.GasLimit), new(big.Int).SetUint64(parent.GasLimit))
+	diff.Abs(diff)
+	bound := parent.GasLimit / params.GasLimitBoundDivisor
+	if diff.Uint64() >= bound {
+		return fmt.Errorf("gas limit of block %d changed by %v from %d to %d, the bound is %d", blockNr, diff, parent.GasLimit, header.GasLimit, bound)
+	}
+	if header.GasLimit < params.MinGasLimit {
+		return fmt.Errorf("gas limit of block %d is %d, below the minimum %d", blockNr, header.GasLimit, params.MinGasLimit)
+	}
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("block %d used %d gas, more than its gas limit %d", blockNr, header.GasUsed, header.GasLimit)
+	}
+	return nil
+}
+
+// Verifies the gas limit of every block in [fromBlock, toBlock] against its parent
+func verifyGasLimitRange(fromBlock, toBlock uint64) error {
+	if fromBlock == 0 {
+		fromBlock = 1
+	}
+	parent, err := client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(fromBlock-1))
+	if err != nil {
+		return err
+	}
+	for blockNr := fromBlock; blockNr <= toBlock; blockNr++ {
+		header, err := client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(blockNr))
+		if err != nil {
+			return err
+		}
+		log.Printf("Block %d: gasLimit = %d, gasUsed = %d, gas target = %d\n", blockNr, header.GasLimit, header.GasUsed, header.GasLimit/params.ElasticityMultiplier)
+		err = verifyGasLimit(parent, header)
+		if err != nil {
+			return err
+		}
+		parent = header
+	}
+	return nil
+}
+
+// PRE-HERTZ TEST CASES
+
+func testGasLimitUnderLoadPreHertz() error {
+	gasBurner, err := deployGasBurner()
+	if err != nil {
+		return err
+	}
+	firstBlock, lastBlock, err := submitLoad(gasBurner, preHertzLoadBlocks)
+	if err != nil {
+		return err
+	}
+	if lastBlock >= config.HertzBlockNumber {
+		return fmt.Errorf("pre-Hertz load was mined up to block %d, after Hertz hard fork block %d", lastBlock, config.HertzBlockNumber)
+	}
+	return verifyGasLimitRange(firstBlock, lastBlock)
+}
+
+// POST-HERTZ TEST CASES
+
+func testGasLimitUnderLoadPostHertz() error {
+	gasBurner, err := deployGasBurner()
+	if err != nil {
+		return err
+	}
+	firstBlock, lastBlock, err := submitLoad(gasBurner, postHertzLoadBlocks)
+	if err != nil {
+		return err
+	}
+	return verifyGasLimitRange(firstBlock, lastBlock)
+}
+
+// The London fork block is where Ethereum doubles the gas limit to keep the gas
+// target unchanged. Parlia must not do that, so the whole range from genesis up to
+// the current block has to follow the bound divisor rule.
+func testGasLimitAcrossForkBlock() error {
+	currentBlock, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	return verifyGasLimitRange(1, currentBlock)
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testGasLimitUnderLoadPreHertz",
+			validationFunction: testGasLimitUnderLoadPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testGasLimitUnderLoadPostHertz",
+			validationFunction: testGasLimitUnderLoadPostHertz,
+		},
+		{
+			name:               "testGasLimitAcrossForkBlock",
+			validationFunction: testGasLimitAcrossForkBlock,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
@@ -0,0 +1,633 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var receiverPrivateKey *ecdsa.PrivateKey
+var receiverAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+// Number of transactions the gas price oracle samples in a block, must match the node
+const sampleNumber = 3
+
+// The gas price oracle ignores transactions sent by the miner of a block, and the
+// sender is the etherbase of the node, so the load is sent by the receiver instead
+var receiverFunding = big.NewInt(1000000000000000000) // 1 ETH
+
+// Tips of the load, in multiples of the miner gas price. Each row is sent in its own
+// block. The post-Hertz load fills most of the blocks the oracle samples, so that the
+// percentile of the samples is one of its tips and above the miner gas price.
+var preHertzLoadTips = [][]int64{{3, 1, 2}, {5, 4}}
+var postHertzLoadTips = [][]int64{
+	{2, 3, 4}, {5, 6, 7}, {10, 8, 9}, {20, 50, 100}, {200, 2, 3}, {4, 5, 6}, {7, 8, 9},
+	{2, 3, 4}, {5, 6, 7}, {10, 8, 9}, {20, 50, 100}, {200, 2, 3}, {4, 5, 6}, {7, 8, 9},
+}
+
+// The head and the price of the last tip suggestion of the oracle. The oracle starts
+// with its default price, which is the miner gas price, and falls back to its last
+// suggestion for blocks that have nothing to sample.
+var lastHead common.Hash
+var lastPrice = new(big.Int).Set(config.MinerGasPrice)
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	receiverPrivateKey, err = crypto.HexToECDSA(config.ReceiverPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts for the fee accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
+}
+
+// Sends receiverFunding from the sender to the receiver so it can pay for the load
+func fundReceiver() error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: config.MinerGasPrice,
+		Gas:      21000,
+		To:       &receiverAddress,
+		Value:    receiverFunding,
+		Data:     []byte{},
+	})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return err
+	}
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return err
+	}
+	receipt, err := utils.WaitForTransactionReceipt(client, signedTx.Hash())
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+	}
+	return utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+}
+
+// Builds a transfer from the receiver to the sender paying the given tip. When typed
+// is set the transaction type rotates between legacy, access list and dynamic fee.
+func newLoadTx(nonce uint64, tip *big.Int, index int, typed bool) (*types.Transaction, error) {
+	var tx *types.Transaction
+	switch {
+	case !typed || index%3 == 0:
+		tx = types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: tip,
+			Gas:      21000,
+			To:       &senderAddress,
+			Value:    big.NewInt(1),
+			Data:     []byte{},
+		})
+	case index%3 == 1:
+		tx = types.NewTx(&types.AccessListTx{
+			ChainID:  config.ChainId,
+			Nonce:    nonce,
+			GasPrice: tip,
+			Gas:      21000,
+			To:       &senderAddress,
+			Value:    big.NewInt(1),
+			Data:     []byte{},
+		})
+	default:
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID:   config.ChainId,
+			Nonce:     nonce,
+			GasTipCap: tip,
+			GasFeeCap: new(big.Int).Mul(tip, big.NewInt(2)),
+			Gas:       21000,
+			To:        &senderAddress,
+			Value:     big.NewInt(1),
+			Data:      []byte{},
+		})
+	}
+	return types.SignTx(tx, types.NewLondonSigner(config.ChainId), receiverPrivateKey)
+}
+
+// Sends the load one row of tips at a time, waiting for each row to be mined before
+// sending the next one. Returns the block the last transaction was mined in.
+func sendLoad(loadTips [][]int64, typed bool) (uint64, error) {
+	var lastBlock uint64
+	for _, row := range loadTips {
+		nonce, err := client.PendingNonceAt(context.Background(), receiverAddress)
+		if err != nil {
+			return 0, err
+		}
+		txHashes := make([]common.Hash, len(row))
+		for i, multiple := range row {
+			tip := new(big.Int).Mul(config.MinerGasPrice, big.NewInt(multiple))
+			signedTx, err := newLoadTx(nonce+uint64(i), tip, i, typed)
+			if err != nil {
+				return 0, err
+			}
+			err = client.SendTransaction(context.Background(), signedTx)
+			if err != nil {
+				return 0, err
+			}
+			txHashes[i] = signedTx.Hash()
+		}
+		for _, txHash := range txHashes {
+			receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+			if err != nil {
+				return 0, err
+			}
+			if receipt.Status != 1 {
+				return 0, fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+			}
+			err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+			if err != nil {
+				return 0, err
+			}
+			if blockNr := receipt.BlockNumber.Uint64(); blockNr > lastBlock {
+				lastBlock = blockNr
+			}
+		}
+	}
+	log.Printf("Load of %v mined up to block %d\n", loadTips, lastBlock)
+	return lastBlock, nil
+}
+
+// Returns the lowest sampleNumber effective tips of a block the way the oracle samples
+// them: tips under the ignore price and transactions of the block's miner are skipped
+func sampleBlockTips(blockNr uint64) ([]*big.Int, error) {
+	block, err := client.BlockByNumber(context.Background(), new(big.Int).SetUint64(blockNr))
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*types.Transaction, len(block.Transactions()))
+	copy(txs, block.Transactions())
+	sort.SliceStable(txs, func(i, j int) bool {
+		tip1, _ := txs[i].EffectiveGasTip(block.BaseFee())
+		tip2, _ := txs[j].EffectiveGasTip(block.BaseFee())
+		return tip1.Cmp(tip2) < 0
+	})
+
+	signer := types.LatestSignerForChainID(config.ChainId)
+	var tips []*big.Int
+	for _, tx := range txs {
+		tip, _ := tx.EffectiveGasTip(block.BaseFee())
+		if tip.Cmp(config.GpoIgnorePrice) < 0 {
+			continue
+		}
+		sender, err := types.Sender(signer, tx)
+		if err == nil && sender != block.Coinbase() {
+			tips = append(tips, tip)
+			if len(tips) >= sampleNumber {
+				break
+			}
+		}
+	}
+	return tips, nil
+}
+
+// Returns the number of blocks the oracle samples at the given head when their results
+// arrive in the given order. Blocks with a single tip, which includes blocks counting
+// as the previous suggestion, pull in an extra block as long as fewer
+// than twice the configured number of blocks' worth of tips are collected or pending.
+// pick chooses the next result among the pending ones.
+func sampledBlocks(tipCounts map[uint64]int, head uint64, pick func(pending []uint64) int) int {
+	var pending []uint64
+	number := head
+	for len(pending) < config.GpoBlocks && number > 0 {
+		pending = append(pending, number)
+		number--
+	}
+	blocks := len(pending)
+	samples := 0
+	for len(pending) > 0 {
+		i := pick(pending)
+		count := tipCounts[pending[i]]
+		pending = append(pending[:i], pending[i+1:]...)
+		if count == 1 && samples+1+len(pending) < config.GpoBlocks*2 && number > 0 {
+			pending = append(pending, number)
+			number--
+			blocks++
+		}
+		samples += count
+	}
+	return blocks
+}
+
+// Computes the tips the oracle can suggest at the given head and the least number of
+// samples it uses. Blocks with nothing to sample count as the previous suggestion.
+// The node fetches the blocks concurrently, and the order their
+// results arrive in decides how many extra blocks are sampled: results with many tips
+// first sample the fewest, results with a single tip first the most. With more
+// samples than the oracle threshold the suggestion is their percentile, otherwise the
+// previous suggestion is kept. The result is clamped between the default price and
+// the max price.
+func expectedSuggestedTips(head *types.Header, previousPrice *big.Int) ([]*big.Int, int, error) {
+	blockTips := make(map[uint64][]*big.Int)
+	tipCounts := make(map[uint64]int)
+	for blockNr := head.Number.Uint64(); blockNr > 0 && head.Number.Uint64()-blockNr < uint64(config.GpoBlocks*2); blockNr-- {
+		tips, err := sampleBlockTips(blockNr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(tips) == 0 {
+			tips = []*big.Int{previousPrice}
+		}
+		blockTips[blockNr] = tips
+		tipCounts[blockNr] = len(tips)
+	}
+	mostTipsFirst := func(pending []uint64) int {
+		best := 0
+		for i, blockNr := range pending {
+			if tipCounts[blockNr] > tipCounts[pending[best]] {
+				best = i
+			}
+		}
+		return best
+	}
+	fewestTipsFirst := func(pending []uint64) int {
+		best := 0
+		for i, blockNr := range pending {
+			if tipCounts[blockNr] < tipCounts[pending[best]] {
+				best = i
+			}
+		}
+		return best
+	}
+	minBlocks := sampledBlocks(tipCounts, head.Number.Uint64(), mostTipsFirst)
+	maxBlocks := sampledBlocks(tipCounts, head.Number.Uint64(), fewestTipsFirst)
+
+	var prices []*big.Int
+	minSamples := 0
+	for blocks := minBlocks; blocks <= maxBlocks; blocks++ {
+		var samples []*big.Int
+		for blockNr := head.Number.Uint64(); blockNr > head.Number.Uint64()-uint64(blocks); blockNr-- {
+			samples = append(samples, blockTips[blockNr]...)
+		}
+		if blocks == minBlocks {
+			minSamples = len(samples)
+		}
+		price := previousPrice
+		if len(samples) > config.GpoOracleThreshold {
+			sort.Slice(samples, func(i, j int) bool {
+				return samples[i].Cmp(samples[j]) < 0
+			})
+			price = samples[(len(samples)-1)*config.GpoPercentile/100]
+		}
+		if price.Cmp(config.MinerGasPrice) < 0 {
+			price = config.MinerGasPrice
+		}
+		if price.Cmp(config.GpoMaxPrice) > 0 {
+			price = config.GpoMaxPrice
+		}
+		prices = append(prices, new(big.Int).Set(price))
+	}
+	return prices, minSamples, nil
+}
+
+// Calls eth_gasPrice and eth_maxPriorityFeePerGas at the same head, retrying if a
+// block is mined in between, and checks them against the oracle rules. Returns the
+// number of tips the oracle sampled, which is 0 if it returned its suggestion for the
+// same head again.
+func checkSuggestedPrices() (int, error) {
+	for {
+		head, err := client.HeaderByNumber(context.Background(), nil)
+		if err != nil {
+			return 0, err
+		}
+		gasPrice, err := client.SuggestGasPrice(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		gasTipCap, err := client.SuggestGasTipCap(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		headAfter, err := client.HeaderByNumber(context.Background(), nil)
+		if err != nil {
+			return 0, err
+		}
+		if head.Hash() != headAfter.Hash() {
+			lastHead, lastPrice = headAfter.Hash(), gasTipCap
+			continue
+		}
+
+		expectedTips := []*big.Int{lastPrice}
+		samples := 0
+		if head.Hash() != lastHead {
+			expectedTips, samples, err = expectedSuggestedTips(head, lastPrice)
+			if err != nil {
+				return 0, err
+			}
+		}
+		lastHead, lastPrice = head.Hash(), gasTipCap
+		log.Printf("Block %v: eth_gasPrice = %v, eth_maxPriorityFeePerGas = %v, %d samples\n", head.Number, gasPrice, gasTipCap, samples)
+
+		matched := false
+		for _, expectedTip := range expectedTips {
+			matched = matched || gasTipCap.Cmp(expectedTip) == 0
+		}
+		if !matched {
+			return 0, fmt.Errorf("eth_maxPriorityFeePerGas at block %v is %v, expected one of %v", head.Number, gasTipCap, expectedTips)
+		}
+		if gasTipCap.Cmp(config.MinerGasPrice) < 0 {
+			return 0, fmt.Errorf("eth_maxPriorityFeePerGas at block %v is %v, below the miner gas price %v", head.Number, gasTipCap, config.MinerGasPrice)
+		}
+		if gasTipCap.Cmp(config.GpoMaxPrice) > 0 {
+			return 0, fmt.Errorf("eth_maxPriorityFeePerGas at block %v is %v, above the max price %v", head.Number, gasTipCap, config.GpoMaxPrice)
+		}
+		// eth_gasPrice is the suggested tip plus the base fee of the head, if it has one
+		expectedGasPrice := new(big.Int).Set(gasTipCap)
+		if head.BaseFee != nil {
+			expectedGasPrice.Add(expectedGasPrice, head.BaseFee)
+		}
+		if gasPrice.Cmp(expectedGasPrice) != 0 {
+			return 0, fmt.Errorf("eth_gasPrice at block %v is %v, expected %v", head.Number, gasPrice, expectedGasPrice)
+		}
+		return samples, nil
+	}
+}
+
+// Checks the suggested prices at a new head and that the oracle used the percentile
+// of its samples, which needs a threshold below the number of samples
+func checkSampledSuggestion() error {
+	for {
+		samples, err := checkSuggestedPrices()
+		if err != nil {
+			return err
+		}
+		if samples == 0 {
+			// The suggestion was already computed at this head, wait for the next one
+			head, err := client.BlockNumber(context.Background())
+			if err != nil {
+				return err
+			}
+			err = utils.WaitForBlockNumber(client, head+1)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if samples <= config.GpoOracleThreshold {
+			return fmt.Errorf("the oracle kept its previous suggestion with %d samples, its threshold %d is too high", samples, config.GpoOracleThreshold)
+		}
+		return nil
+	}
+}
+
+// PRE-HERTZ TEST CASES
+
+func testOracleUnderLoadPreHertz() error {
+	err := fundReceiver()
+	if err != nil {
+		return err
+	}
+	_, err = checkSuggestedPrices()
+	if err != nil {
+		return err
+	}
+	lastBlock, err := sendLoad(preHertzLoadTips, false)
+	if err != nil {
+		return err
+	}
+	if lastBlock >= config.HertzBlockNumber {
+		return fmt.Errorf("pre-Hertz load was mined up to block %d, after Hertz hard fork block %d", lastBlock, config.HertzBlockNumber)
+	}
+	return checkSampledSuggestion()
+}
+
+// Transactions sent by the miner are never sampled, whatever their tips
+func testOracleIgnoresMinerTxsPreHertz() error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: config.GpoMaxPrice,
+		Gas:      21000,
+		To:       &receiverAddress,
+		Value:    big.NewInt(1),
+		Data:     []byte{},
+	})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return err
+	}
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return err
+	}
+	receipt, err := utils.WaitForTransactionReceipt(client, signedTx.Hash())
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return err
+	}
+	block, err := client.BlockByNumber(context.Background(), receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	if block.Coinbase() != senderAddress {
+		return fmt.Errorf("block %v was mined by %v, expected the sender %v to be the miner", receipt.BlockNumber, block.Coinbase(), senderAddress)
+	}
+	tips, err := sampleBlockTips(receipt.BlockNumber.Uint64())
+	if err != nil {
+		return err
+	}
+	for _, tip := range tips {
+		if tip.Cmp(config.GpoMaxPrice) == 0 {
+			return fmt.Errorf("the tip of the miner's transaction was sampled in block %v", receipt.BlockNumber)
+		}
+	}
+	_, err = checkSuggestedPrices()
+	return err
+}
+
+// POST-HERTZ TEST CASES
+
+// Legacy, access list and dynamic fee transactions with a spread of tips, including
+// tips above the max price. The load has to raise the suggestion above the miner gas
+// price, and with a zero base fee eth_gasPrice has to stay equal to
+// eth_maxPriorityFeePerGas.
+func testOracleUnderLoadPostHertz() error {
+	err := fundReceiver()
+	if err != nil {
+		return err
+	}
+	_, err = checkSuggestedPrices()
+	if err != nil {
+		return err
+	}
+	_, err = sendLoad(postHertzLoadTips, true)
+	if err != nil {
+		return err
+	}
+	head, err := client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	if head.BaseFee == nil || head.BaseFee.Sign() != 0 {
+		return fmt.Errorf("base fee of block %v is %v, expected 0", head.Number, head.BaseFee)
+	}
+	err = checkSampledSuggestion()
+	if err != nil {
+		return err
+	}
+	if lastPrice.Cmp(config.MinerGasPrice) <= 0 {
+		return fmt.Errorf("eth_maxPriorityFeePerGas is %v after the load, expected it above the miner gas price %v", lastPrice, config.MinerGasPrice)
+	}
+	return nil
+}
+
+// The suggestion of the oracle is recomputed at every new head, so it has to keep
+// following the rules while blocks without load push the load out of its samples
+func testOracleAfterLoadPostHertz() error {
+	head, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	for i := uint64(1); i <= 3; i++ {
+		err = utils.WaitForBlockNumber(client, head+i)
+		if err != nil {
+			return err
+		}
+		err = checkSampledSuggestion()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var testOracleIgnoresMinerTxsPostHertz = testOracleIgnoresMinerTxsPreHertz
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testOracleUnderLoadPreHertz",
+			validationFunction: testOracleUnderLoadPreHertz,
+		},
+		{
+			name:               "testOracleIgnoresMinerTxsPreHertz",
+			validationFunction: testOracleIgnoresMinerTxsPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testOracleUnderLoadPostHertz",
+			validationFunction: testOracleUnderLoadPostHertz,
+		},
+		{
+			name:               "testOracleAfterLoadPostHertz",
+			validationFunction: testOracleAfterLoadPostHertz,
+		},
+		{
+			name:               "testOracleIgnoresMinerTxsPostHertz",
+			validationFunction: testOracleIgnoresMinerTxsPostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// The header fields of eth_getBlockByNumber as they are sent by the node
+type rpcHeader struct {
+	Hash        *common.Hash      `json:"hash"`
+	ParentHash  *common.Hash      `json:"parentHash"`
+	UncleHash   *common.Hash      `json:"sha3Uncles"`
+	Coinbase    *common.Address   `json:"miner"`
+	Root        *common.Hash      `json:"stateRoot"`
+	TxHash      *common.Hash      `json:"transactionsRoot"`
+	ReceiptHash *common.Hash      `json:"receiptsRoot"`
+	Bloom       *types.Bloom      `json:"logsBloom"`
+	Difficulty  *hexutil.Big      `json:"difficulty"`
+	Number      *hexutil.Big      `json:"number"`
+	GasLimit    *hexutil.Uint64   `json:"gasLimit"`
+	GasUsed     *hexutil.Uint64   `json:"gasUsed"`
+	Time        *hexutil.Uint64   `json:"timestamp"`
+	Extra       *hexutil.Bytes    `json:"extraData"`
+	MixDigest   *common.Hash      `json:"mixHash"`
+	Nonce       *types.BlockNonce `json:"nonce"`
+	BaseFee     *hexutil.Big      `json:"baseFeePerGas"`
+}
+
+// Block fields that are not part of the header and therefore not part of its hash
+var nonHeaderFields = map[string]bool{
+	"hash":            true,
+	"size":            true,
+	"totalDifficulty": true,
+	"transactions":    true,
+	"uncles":          true,
+}
+
+// Header fields that the recomputation below knows how to encode
+var headerFields = map[string]bool{
+	"parentHash":       true,
+	"sha3Uncles":       true,
+	"miner":            true,
+	"stateRoot":        true,
+	"transactionsRoot": true,
+	"receiptsRoot":     true,
+	"logsBloom":        true,
+	"difficulty":       true,
+	"number":           true,
+	"gasLimit":         true,
+	"gasUsed":          true,
+	"timestamp":        true,
+	"extraData":        true,
+	"mixHash":          true,
+	"nonce":            true,
+	"baseFeePerGas":    true,
+}
+
+const extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for signer vanity
+const extraSeal = 65   // Fixed number of extra-data suffix bytes reserved for signer seal
+
+// Number of blocks after the post-Hertz block to include in the header checks
+var blocksAfterHertz uint64 = 5
+
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+func init() {
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// header fields exactly as the node serves them.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+}
+
+// Fetches a block header with eth_getBlockByNumber and returns both the decoded
+// fields and the names of all fields present in the response
+func getRPCHeader(blockNr uint64) (*rpcHeader, map[string]json.RawMessage, error) {
+	var raw json.RawMessage
+	err := rpcClient.CallContext(context.Background(), &raw, "eth_getBlockByNumber", hexutil.EncodeUint64(blockNr), false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil, fmt.Errorf("block %d not found", blockNr)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, nil, err
+	}
+	var header rpcHeader
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, nil, err
+	}
+	return &header, fields, nil
+}
+
+// Rebuilds a types.Header from the RPC fields. Every consensus field has to be present.
+func (h *rpcHeader) toHeader() (*types.Header, error) {
+	if h.ParentHash == nil || h.UncleHash == nil || h.Coinbase == nil || h.Root == nil || h.TxHash == nil ||
+		h.ReceiptHash == nil || h.Bloom == nil || h.Difficulty == nil || h.Number == nil || h.GasLimit == nil ||
+		h.GasUsed == nil || h.Time == nil || h.Extra == nil || h.MixDigest == nil || h.Nonce == nil {
+		return nil, errors.New("header is missing one or more consensus fields")
+	}
+	header := &types.Header{
+		ParentHash:  *h.ParentHash,
+		UncleHash:   *h.UncleHash,
+		Coinbase:    *h.Coinbase,
+		Root:        *h.Root,
+		TxHash:      *h.TxHash,
+		ReceiptHash: *h.ReceiptHash,
+		Bloom:       *h.Bloom,
+		Difficulty:  (*big.Int)(h.Difficulty),
+		Number:      (*big.Int)(h.Number),
+		GasLimit:    uint64(*h.GasLimit),
+		GasUsed:     uint64(*h.GasUsed),
+		Time:        uint64(*h.Time),
+		Extra:       *h.Extra,
+		MixDigest:   *h.MixDigest,
+		Nonce:       *h.Nonce,
+	}
+	if h.BaseFee != nil {
+		header.BaseFee = (*big.Int)(h.BaseFee)
+	}
+	return header, nil
+}
+
+// Returns the hash Parlia signs: the header without the seal, prefixed by the chain id
+func sealHash(header *types.Header) (common.Hash, error) {
+	encoded, err := rlp.EncodeToBytes([]interface{}{
+		config.ChainId,
+		header.ParentHash,
+		header.UncleHash,
+		header.Coinbase,
+		header.Root,
+		header.TxHash,
+		header.ReceiptHash,
+		header.Bloom,
+		header.Difficulty,
+		header.Number,
+		header.GasLimit,
+		header.GasUsed,
+		header.Time,
+		header.Extra[:len(header.Extra)-extraSeal],
+		header.MixDigest,
+		header.Nonce,
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// Checks the Parlia layout of extraData: vanity, the validator set on epoch blocks, seal.
+// Every block except genesis must be sealed by its miner.
+func verifyParliaExtra(header *types.Header) error {
+	blockNr := header.Number.Uint64()
+	extra := header.Extra
+	if len(extra) < extraVanity+extraSeal {
+		return fmt.Errorf("extraData of block %d is %d bytes long, shorter than vanity and seal", blockNr, len(extra))
+	}
+	validatorsLen := len(extra) - extraVanity - extraSeal
+	if blockNr%config.ParliaEpoch == 0 {
+		if validatorsLen == 0 || validatorsLen%common.AddressLength != 0 {
+			return fmt.Errorf("extraData of epoch block %d has %d validator bytes, expected a non-empty multiple of %d", blockNr, validatorsLen, common.AddressLength)
+		}
+	} else if validatorsLen != 0 {
+		return fmt.Errorf("extraData of non-epoch block %d has %d unexpected validator bytes", blockNr, validatorsLen)
+	}
+	if blockNr == 0 {
+		return nil
+	}
+
+	hash, err := sealHash(header)
+	if err != nil {
+		return err
+	}
+	pubkey, err := crypto.SigToPub(hash.Bytes(), extra[len(extra)-extraSeal:])
+	if err != nil {
+		return fmt.Errorf("failed to recover the signer of block %d: %v", blockNr, err)
+	}
+	if signer := crypto.PubkeyToAddress(*pubkey); signer != header.Coinbase {
+		return fmt.Errorf("block %d is sealed by %v but its miner is %v", blockNr, signer, header.Coinbase)
+	}
+	return nil
+}
+
+// Rebuilds the header of a block from the RPC fields and checks that it hashes to
+// the hash reported by the node, that it links to its parent and that its fork
+// dependent fields are consistent with the Hertz block.
+func verifyHeader(blockNr uint64, parentHash common.Hash) (common.Hash, error) {
+	rpcHeader, fields, err := getRPCHeader(blockNr)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	// A field the node adds to the header but we don't encode would make the hash
+	// check below fail for the wrong reason, so report it explicitly
+	var unknownFields []string
+	for field := range fields {
+		if !headerFields[field] && !nonHeaderFields[field] {
+			unknownFields = append(unknownFields, field)
+		}
+	}
+	if len(unknownFields) > 0 {
+		sort.Strings(unknownFields)
+		return common.Hash{}, fmt.Errorf("block %d has unknown header fields %v", blockNr, unknownFields)
+	}
+	if rpcHeader.Hash == nil {
+		return common.Hash{}, fmt.Errorf("block %d has no hash field", blockNr)
+	}
+	header, err := rpcHeader.toHeader()
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("block %d: %v", blockNr, err)
+	}
+
+	if header.Number.Uint64() != blockNr {
+		return common.Hash{}, fmt.Errorf("requested block %d but got block %v", blockNr, header.Number)
+	}
+	if hash := header.Hash(); hash != *rpcHeader.Hash {
+		return common.Hash{}, fmt.Errorf("recomputed hash of block %d is %v but the node reports %v", blockNr, hash, *rpcHeader.Hash)
+	}
+	if blockNr > 0 && header.ParentHash != parentHash {
+		return common.Hash{}, fmt.Errorf("parentHash of block %d is %v, expected %v", blockNr, header.ParentHash, parentHash)
+	}
+
+	// baseFeePerGas is part of the header, and therefore of its hash, only from the Hertz block on
+	if blockNr < config.HertzBlockNumber {
+		if header.BaseFee != nil {
+			return common.Hash{}, fmt.Errorf("pre-Hertz block %d has baseFeePerGas %v", blockNr, header.BaseFee)
+		}
+	} else {
+		if header.BaseFee == nil {
+			return common.Hash{}, fmt.Errorf("post-Hertz block %d has no baseFeePerGas", blockNr)
+		}
+		if header.BaseFee.Sign() != 0 {
+			return common.Hash{}, fmt.Errorf("post-Hertz block %d has baseFeePerGas %v, expected 0", blockNr, header.BaseFee)
+		}
+	}
+
+	err = verifyParliaExtra(header)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return *rpcHeader.Hash, nil
+}
+
+func testHeaderHashesFromGenesis() error {
+	lastBlock := config.PostHertzBlockNumber + blocksAfterHertz
+	var parentHash common.Hash
+	for blockNr := uint64(0); blockNr <= lastBlock; blockNr++ {
+		parentHash, err = verifyHeader(blockNr, parentHash)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Verified the headers of blocks 0 to %d\n", lastBlock)
+	return nil
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runHeaderTests() {
+	testCases := []TestCase{
+		{
+			name:               "testHeaderHashesFromGenesis",
+			validationFunction: testHeaderHashesFromGenesis,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+// The headers are historical data, so unlike the other suites these checks can
+// run at any time after the last block of the range has been mined
+func main() {
+	lastBlock := config.PostHertzBlockNumber + blocksAfterHertz
+	log.Printf("Waiting for block number %v to start running the test cases...\n", lastBlock)
+	err := utils.WaitForBlockNumber(client, lastBlock)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", lastBlock)
+	runHeaderTests()
+	fmt.Println("ALL TESTS PASSED!")
+}
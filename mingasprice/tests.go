@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// How a fee field relates to the minimum gas price of the miner
+type priceLevel int
+
+const (
+	belowMin priceLevel = iota // 1 wei below the minimum
+	atMin
+	aboveMin // 1 wei above the minimum
+)
+
+func (level priceLevel) String() string {
+	switch level {
+	case belowMin:
+		return "below the minimum"
+	case atMin:
+		return "at the minimum"
+	case aboveMin:
+		return "above the minimum"
+	}
+	return fmt.Sprintf("priceLevel(%d)", int(level))
+}
+
+func (level priceLevel) price() *big.Int {
+	switch level {
+	case belowMin:
+		return new(big.Int).Sub(config.MinerGasPrice, common.Big1)
+	case aboveMin:
+		return new(big.Int).Add(config.MinerGasPrice, common.Big1)
+	}
+	return new(big.Int).Set(config.MinerGasPrice)
+}
+
+// What happened to a transaction after it was sent
+type inclusionOutcome int
+
+const (
+	outcomeRejected inclusionOutcome = iota // refused by eth_sendRawTransaction
+	outcomeMined                            // included in a block
+	outcomePending                          // still in the pool, but not mined
+	outcomeDropped                          // neither mined nor in the pool
+)
+
+func (outcome inclusionOutcome) String() string {
+	switch outcome {
+	case outcomeRejected:
+		return "rejected"
+	case outcomeMined:
+		return "mined"
+	case outcomePending:
+		return fmt.Sprintf("pending but not mined after %d blocks", observationBlocks)
+	case outcomeDropped:
+		return "dropped from the pool without being mined"
+	}
+	return fmt.Sprintf("inclusionOutcome(%d)", int(outcome))
+}
+
+// A transaction with its fee fields at a level relative to the miner gas price.
+// Legacy and access list transactions have a single gas price, which is set by tipLevel.
+type MinGasPriceCase struct {
+	txType      byte
+	tipLevel    priceLevel
+	feeCapLevel priceLevel
+}
+
+func (minGasPriceCase MinGasPriceCase) String() string {
+	if minGasPriceCase.txType != types.DynamicFeeTxType {
+		return fmt.Sprintf("type %d with gas price %v", minGasPriceCase.txType, minGasPriceCase.tipLevel)
+	}
+	return fmt.Sprintf("type %d with tip %v and fee cap %v", minGasPriceCase.txType, minGasPriceCase.tipLevel, minGasPriceCase.feeCapLevel)
+}
+
+var singlePriceLevels = []priceLevel{belowMin, atMin, aboveMin}
+
+// Tip and fee cap levels of dynamic fee transactions, the tip can't be above the fee cap
+var dynamicFeeLevels = [][2]priceLevel{
+	{belowMin, belowMin},
+	{belowMin, aboveMin},
+	{atMin, atMin},
+	{atMin, aboveMin},
+	{aboveMin, aboveMin},
+}
+
+// Number of blocks a transaction is given to be mined before its outcome is decided
+const observationBlocks = 3
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts for the fee accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+}
+
+func minGasPriceCases(txTypes []byte) []MinGasPriceCase {
+	var cases []MinGasPriceCase
+	for _, txType := range txTypes {
+		if txType != types.DynamicFeeTxType {
+			for _, level := range singlePriceLevels {
+				cases = append(cases, MinGasPriceCase{txType, level, level})
+			}
+			continue
+		}
+		for _, levels := range dynamicFeeLevels {
+			cases = append(cases, MinGasPriceCase{txType, levels[0], levels[1]})
+		}
+	}
+	return cases
+}
+
+// The pool refuses transactions with a tip below the miner gas price, unless they
+// are local. Transactions sent over RPC are local unless the node runs with
+// --txpool.nolocals, and the miner has no price filter of its own: it includes every
+// transaction in the pool whatever its tip. So no case is expected to stay pending,
+// a below minimum transaction is either mined or rejected.
+func expectedOutcome(minGasPriceCase MinGasPriceCase) (inclusionOutcome, error) {
+	if minGasPriceCase.tipLevel == belowMin && config.TxPoolNoLocals {
+		return outcomeRejected, core.ErrUnderpriced
+	}
+	return outcomeMined, nil
+}
+
+// Legacy and access list transactions pay the tip level as their gas price
+func signCaseTx(minGasPriceCase MinGasPriceCase, key *ecdsa.PrivateKey) (*types.Transaction, error) {
+	p := utils.TxParams{
+		Nonce:     0,
+		GasFeeCap: minGasPriceCase.tipLevel.price(),
+		GasTipCap: minGasPriceCase.tipLevel.price(),
+		Gas:       params.TxGas,
+		To:        &senderAddress,
+		Value:     big.NewInt(1),
+	}
+	switch minGasPriceCase.txType {
+	case types.AccessListTxType:
+		p.Gas += params.TxAccessListAddressGas
+		p.AccessList = types.AccessList{{
+			Address:     senderAddress,
+			StorageKeys: nil,
+		}}
+	case types.DynamicFeeTxType:
+		p.GasFeeCap = minGasPriceCase.feeCapLevel.price()
+	}
+	return utils.SignNewTx(minGasPriceCase.txType, p, key)
+}
+
+// Classifies a transaction that was accepted by the pool once it had
+// observationBlocks blocks to be mined
+func observeOutcome(tx *types.Transaction) (inclusionOutcome, error) {
+	receipt, err := client.TransactionReceipt(context.Background(), tx.Hash())
+	if err == nil {
+		if receipt.Status != 1 {
+			return outcomeMined, fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+		}
+		return outcomeMined, utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	}
+	if err != ethereum.NotFound {
+		return outcomeMined, err
+	}
+	_, isPending, err := client.TransactionByHash(context.Background(), tx.Hash())
+	if err == ethereum.NotFound {
+		return outcomeDropped, nil
+	}
+	if err != nil {
+		return outcomePending, err
+	}
+	if !isPending {
+		// Mined between the two lookups
+		return outcomeMined, nil
+	}
+	return outcomePending, nil
+}
+
+// Sends a transaction for every case from its own account, gives the accepted ones
+// observationBlocks blocks to be mined and compares the outcome of every case with the
+// policy of the pool and the miner. All the outcomes are logged before the first
+// mismatch is returned, a transaction that is never mined is reported as pending
+// rather than as a receipt timeout.
+func runMinGasPriceCases(cases []MinGasPriceCase) error {
+	// Every case has its own account, so that a transaction that is never mined
+	// doesn't hold back the transactions of the other cases
+	keys, err := utils.FundAccounts(client, senderPrivateKey, len(cases))
+	if err != nil {
+		return err
+	}
+
+	txs := make([]*types.Transaction, len(cases))
+	outcomes := make([]inclusionOutcome, len(cases))
+	sendErrs := make([]error, len(cases))
+	for i, minGasPriceCase := range cases {
+		txs[i], err = signCaseTx(minGasPriceCase, keys[i])
+		if err != nil {
+			return err
+		}
+		sendErrs[i] = client.SendTransaction(context.Background(), txs[i])
+		if sendErrs[i] != nil {
+			outcomes[i] = outcomeRejected
+		}
+	}
+
+	head, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	log.Printf("Waiting for block number %v to classify the outcomes...\n", head+observationBlocks)
+	err = utils.WaitForBlockNumber(client, head+observationBlocks)
+	if err != nil {
+		return err
+	}
+
+	var mismatch error
+	for i, minGasPriceCase := range cases {
+		if sendErrs[i] == nil {
+			outcomes[i], err = observeOutcome(txs[i])
+			if err != nil {
+				return fmt.Errorf("%v: %v", minGasPriceCase, err)
+			}
+		}
+		log.Printf("%v: %v\n", minGasPriceCase, outcomes[i])
+
+		expected, expectedErr := expectedOutcome(minGasPriceCase)
+		if mismatch != nil {
+			continue
+		}
+		if outcomes[i] != expected {
+			mismatch = fmt.Errorf("%v: expected the transaction to be %v, but it was %v", minGasPriceCase, expected, outcomes[i])
+			if sendErrs[i] != nil {
+				mismatch = fmt.Errorf("%v with '%v'", mismatch, sendErrs[i])
+			}
+			continue
+		}
+		if expected == outcomeRejected {
+			err = utils.SentinelError(expectedErr).Match(sendErrs[i])
+			if err != nil {
+				mismatch = fmt.Errorf("%v: %v", minGasPriceCase, err)
+			}
+		}
+	}
+	return mismatch
+}
+
+// PRE-HERTZ TEST CASES
+
+func testMinGasPricePreHertz() error {
+	return runMinGasPriceCases(minGasPriceCases([]byte{types.LegacyTxType}))
+}
+
+// POST-HERTZ TEST CASES
+
+func testMinGasPricePostHertz() error {
+	return runMinGasPriceCases(minGasPriceCases([]byte{types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType}))
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testMinGasPricePreHertz",
+			validationFunction: testMinGasPricePreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testMinGasPricePostHertz",
+			validationFunction: testMinGasPricePostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	flag.BoolVar(&config.TxPoolNoLocals, "txpool.nolocals", config.TxPoolNoLocals, "the node runs with --txpool.nolocals")
+	flag.Parse()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// A transaction of the batch, sent by the account with the tips batchTips[account]
+type orderedTx struct {
+	account int
+	tx      *types.Transaction
+}
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+// Tips of the transactions of each account in tenths of the miner gas price, in nonce
+// order. All the tips are distinct, so the order doesn't depend on the arrival time
+// of transactions with the same tip. Every account has a transaction that can only
+// be included after a lower tip one of its own.
+var batchTips = [][]int64{
+	{15, 40, 22},
+	{35, 12, 50},
+	{20, 45, 11},
+	{30, 25, 55},
+}
+
+// Block period of parlia in the genesis config
+const blockPeriod = 3 * time.Second
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to pause and
+	// resume mining with the miner API.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+}
+
+// Stops mining and waits until no new block shows up for two block periods
+func pauseMining() (uint64, error) {
+	err := rpcClient.CallContext(context.Background(), nil, "miner_stop")
+	if err != nil {
+		return 0, err
+	}
+	head, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	for {
+		time.Sleep(2 * blockPeriod)
+		newHead, err := client.BlockNumber(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		if newHead == head {
+			return head, nil
+		}
+		head = newHead
+	}
+}
+
+func resumeMining() error {
+	return rpcClient.CallContext(context.Background(), nil, "miner_start")
+}
+
+// Signs the batch. Even transactions of an account are legacy and odd ones are
+// dynamic fee transactions with a fee cap far above their tip, which doesn't matter
+// for their order since the base fee is 0.
+func signBatch(keys []*ecdsa.PrivateKey) ([]orderedTx, error) {
+	signer := types.NewLondonSigner(config.ChainId)
+	var batch []orderedTx
+	for account, tips := range batchTips {
+		for nonce, tenths := range tips {
+			tip := new(big.Int).Mul(config.MinerGasPrice, big.NewInt(tenths))
+			tip.Div(tip, big.NewInt(10))
+			var tx *types.Transaction
+			if nonce%2 == 0 {
+				tx = types.NewTx(&types.LegacyTx{
+					Nonce:    uint64(nonce),
+					GasPrice: tip,
+					Gas:      params.TxGas,
+					To:       &senderAddress,
+					Value:    big.NewInt(1),
+				})
+			} else {
+				tx = types.NewTx(&types.DynamicFeeTx{
+					ChainID:   config.ChainId,
+					Nonce:     uint64(nonce),
+					GasFeeCap: new(big.Int).Mul(tip, big.NewInt(10)),
+					GasTipCap: tip,
+					Gas:       params.TxGas,
+					To:        &senderAddress,
+					Value:     big.NewInt(1),
+				})
+			}
+			signedTx, err := types.SignTx(tx, signer, keys[account])
+			if err != nil {
+				return nil, err
+			}
+			batch = append(batch, orderedTx{account: account, tx: signedTx})
+		}
+	}
+	return batch, nil
+}
+
+// Returns the batch in the order of the miner: the executable transaction with the
+// highest effective tip goes first, where only the lowest nonce transaction of every
+// account is executable. With a zero base fee the effective tip is the tip.
+func expectedOrder(batch []orderedTx, baseFee *big.Int) []orderedTx {
+	queues := make([][]orderedTx, len(batchTips))
+	for _, item := range batch {
+		queues[item.account] = append(queues[item.account], item)
+	}
+	var order []orderedTx
+	for len(order) < len(batch) {
+		best := -1
+		var bestTip *big.Int
+		for account, queue := range queues {
+			if len(queue) == 0 {
+				continue
+			}
+			tip := queue[0].tx.EffectiveGasTipValue(baseFee)
+			if best == -1 || tip.Cmp(bestTip) > 0 {
+				best, bestTip = account, tip
+			}
+		}
+		order = append(order, queues[best][0])
+		queues[best] = queues[best][1:]
+	}
+	return order
+}
+
+// Submits a batch of legacy and dynamic fee transactions of several accounts while
+// mining is paused, resumes mining and checks that the batch is mined ordered by
+// effective tip while keeping the nonce order of every account
+func testOrderingByTipPostHertz() error {
+	// An account for every row of batchTips
+	keys, err := utils.FundAccounts(client, senderPrivateKey, len(batchTips))
+	if err != nil {
+		return err
+	}
+	batch, err := signBatch(keys)
+	if err != nil {
+		return err
+	}
+
+	pausedHead, err := pauseMining()
+	if err != nil {
+		return err
+	}
+	log.Printf("Mining paused at block %v\n", pausedHead)
+	resumed := false
+	defer func() {
+		if !resumed {
+			err := resumeMining()
+			if err != nil {
+				log.Println("Failed to resume mining: ", err)
+			}
+		}
+	}()
+
+	// Send the batch in reverse so that the arrival order differs from the expected order
+	for i := len(batch) - 1; i >= 0; i-- {
+		err = client.SendTransaction(context.Background(), batch[i].tx)
+		if err != nil {
+			return err
+		}
+	}
+	head, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	if head != pausedHead {
+		return fmt.Errorf("block %v was mined while mining was paused at block %v", head, pausedHead)
+	}
+	err = resumeMining()
+	if err != nil {
+		return err
+	}
+	resumed = true
+	log.Println("Mining resumed")
+
+	// Collect the batch in the order it was mined, skipping other transactions
+	batchByHash := make(map[common.Hash]orderedTx)
+	for _, item := range batch {
+		batchByHash[item.tx.Hash()] = item
+	}
+	var mined []orderedTx
+	var baseFee *big.Int
+	lastBlock := pausedHead
+	for _, item := range batch {
+		receipt, err := utils.WaitForTransactionReceipt(client, item.tx.Hash())
+		if err != nil {
+			return err
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return err
+		}
+		if receipt.BlockNumber.Uint64() > lastBlock {
+			lastBlock = receipt.BlockNumber.Uint64()
+		}
+	}
+	for blockNr := pausedHead + 1; blockNr <= lastBlock; blockNr++ {
+		block, err := client.BlockByNumber(context.Background(), new(big.Int).SetUint64(blockNr))
+		if err != nil {
+			return err
+		}
+		if block.BaseFee() == nil || block.BaseFee().Sign() != 0 {
+			return fmt.Errorf("BaseFee is not 0 at post-Hertz block number %v", blockNr)
+		}
+		baseFee = block.BaseFee()
+		for _, tx := range block.Transactions() {
+			if item, ok := batchByHash[tx.Hash()]; ok {
+				mined = append(mined, item)
+			}
+		}
+	}
+	if lastBlock > pausedHead+1 {
+		log.Printf("The batch was split over blocks %v to %v\n", pausedHead+1, lastBlock)
+	}
+
+	if len(mined) != len(batch) {
+		return fmt.Errorf("found %d transactions of the batch in blocks %v to %v, expected %d", len(mined), pausedHead+1, lastBlock, len(batch))
+	}
+
+	// Nonce order of every account
+	nextNonce := make(map[int]uint64)
+	for i, item := range mined {
+		if item.tx.Nonce() != nextNonce[item.account] {
+			return fmt.Errorf("position %d: account %d has nonce %d mined, expected nonce %d", i, item.account, item.tx.Nonce(), nextNonce[item.account])
+		}
+		nextNonce[item.account]++
+	}
+
+	// Order by effective tip
+	expected := expectedOrder(batch, baseFee)
+	for i := range expected {
+		if mined[i].tx.Hash() != expected[i].tx.Hash() {
+			return fmt.Errorf("position %d: mined transaction of account %d with nonce %d and tip %v, expected account %d with nonce %d and tip %v",
+				i, mined[i].account, mined[i].tx.Nonce(), mined[i].tx.GasTipCap(), expected[i].account, expected[i].tx.Nonce(), expected[i].tx.GasTipCap())
+		}
+	}
+	return nil
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testOrderingByTipPostHertz",
+			validationFunction: testOrderingByTipPostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+// The ordering is only checked after Hertz. Mining is paused while the batch is
+// submitted, so other suites must not run at the same time.
+func main() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	fmt.Println("ALL TESTS PASSED!")
+}
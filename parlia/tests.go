@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// How the fees collected in a block were distributed by Parlia during finalization
+type feeDistribution struct {
+	blockNr          *big.Int
+	fees             *big.Int // sum of gasUsed * effectiveGasPrice of the block's transactions
+	systemReward     *big.Int // value of the system transaction to the system reward contract
+	validatorDeposit *big.Int // value of the system transaction to the validator set contract
+	rewardEvent      *big.Int // amount of the receiveDeposit event of the system reward contract
+	depositEvent     *big.Int // amount of the validatorDeposit or deprecatedDeposit event of the validator set contract
+	burnEvent        *big.Int // amount of the feeBurned event of the validator set contract
+}
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var receiverPrivateKey *ecdsa.PrivateKey
+var receiverAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+// Gas limit of the messages Parlia builds its system transactions from
+const systemTxGas = math.MaxUint64 / 2
+
+// Events of the system contracts emitted when the fees are distributed
+var receiveDepositTopic = crypto.Keccak256Hash([]byte("receiveDeposit(address,uint256)"))
+var validatorDepositTopic = crypto.Keccak256Hash([]byte("validatorDeposit(address,uint256)"))
+var deprecatedDepositTopic = crypto.Keccak256Hash([]byte("deprecatedDeposit(address,uint256)"))
+var feeBurnedTopic = crypto.Keccak256Hash([]byte("feeBurned(uint256)"))
+
+// Selector of deposit(address) of the validator set contract
+var depositSelector = crypto.Keccak256([]byte("deposit(address)"))[:4]
+
+// The gas price of the pre-Hertz legacy transaction and the tip of the post-Hertz
+// dynamic fee transaction, so that both pay the same fees
+var feePerGas = new(big.Int).Mul(config.MinerGasPrice, big.NewInt(3))
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	receiverPrivateKey, err = crypto.HexToECDSA(config.ReceiverPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
+}
+
+// Signs and sends a transaction, waits for it to be mined successfully and returns its receipt
+func sendAndWait(tx *types.Transaction) (*types.Receipt, error) {
+	signedTx, err := types.SignTx(tx, types.NewLondonSigner(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	err = client.SendTransaction(context.Background(), signedTx)
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := utils.WaitForTransactionReceipt(client, signedTx.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != 1 {
+		return nil, fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+	}
+	return receipt, nil
+}
+
+// Returns true if the transaction is a system transaction of Parlia: sent by the
+// miner of the block to a system contract for free
+func isSystemTx(tx *types.Transaction, coinbase common.Address) (bool, error) {
+	if tx.To() == nil || tx.GasPrice().Sign() != 0 || !utils.SystemContracts[*tx.To()] {
+		return false, nil
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(config.ChainId), tx)
+	if err != nil {
+		return false, err
+	}
+	return from == coinbase, nil
+}
+
+// Collects the fees of a block together with the system transactions and events
+// that distributed them
+func getFeeDistribution(blockNr *big.Int) (*feeDistribution, error) {
+	block, err := client.BlockByNumber(context.Background(), blockNr)
+	if err != nil {
+		return nil, err
+	}
+	distribution := &feeDistribution{blockNr: blockNr, fees: new(big.Int)}
+	for _, tx := range block.Transactions() {
+		receipt, err := client.TransactionReceipt(context.Background(), tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		effectiveGasPrice, err := utils.EffectiveGasPrice(rpcClient, tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		distribution.fees.Add(distribution.fees, new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), effectiveGasPrice))
+
+		systemTx, err := isSystemTx(tx, block.Coinbase())
+		if err != nil {
+			return nil, err
+		}
+		if !systemTx {
+			continue
+		}
+		switch *tx.To() {
+		case utils.ValidatorContract:
+			if !bytes.HasPrefix(tx.Data(), depositSelector) {
+				continue
+			}
+			if validator := common.BytesToAddress(tx.Data()[4:]); validator != block.Coinbase() {
+				return nil, fmt.Errorf("block %v deposited the fees for %v, expected its miner %v", blockNr, validator, block.Coinbase())
+			}
+			distribution.validatorDeposit = tx.Value()
+		case utils.SystemRewardContract:
+			distribution.systemReward = tx.Value()
+		}
+	}
+
+	hash := block.Hash()
+	logs, err := client.FilterLogs(context.Background(), ethereum.FilterQuery{
+		BlockHash: &hash,
+		Addresses: []common.Address{utils.ValidatorContract, utils.SystemRewardContract},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, vLog := range logs {
+		if len(vLog.Topics) == 0 {
+			continue
+		}
+		amount := new(big.Int).SetBytes(vLog.Data)
+		switch {
+		case vLog.Address == utils.SystemRewardContract && vLog.Topics[0] == receiveDepositTopic:
+			if len(vLog.Topics) != 2 || common.BytesToAddress(vLog.Topics[1].Bytes()) != block.Coinbase() {
+				return nil, fmt.Errorf("receiveDeposit event of block %v is not from its miner %v: %+v", blockNr, block.Coinbase(), vLog)
+			}
+			distribution.rewardEvent = amount
+		case vLog.Address == utils.ValidatorContract && (vLog.Topics[0] == validatorDepositTopic || vLog.Topics[0] == deprecatedDepositTopic):
+			if len(vLog.Topics) != 2 || common.BytesToAddress(vLog.Topics[1].Bytes()) != block.Coinbase() {
+				return nil, fmt.Errorf("deposit event of block %v is not for its miner %v: %+v", blockNr, block.Coinbase(), vLog)
+			}
+			distribution.depositEvent = amount
+		case vLog.Address == utils.ValidatorContract && vLog.Topics[0] == feeBurnedTopic:
+			distribution.burnEvent = amount
+		}
+	}
+	return distribution, nil
+}
+
+// Checks that all the fees of a block were distributed, 1/16 to the system reward
+// contract while it holds less than 100 ether and the rest to the validator set
+// contract, and that the system contracts emitted the matching events
+func verifyFeeDistribution(distribution *feeDistribution) error {
+	blockNr := distribution.blockNr
+	if distribution.fees.Sign() == 0 {
+		if distribution.systemReward != nil || distribution.validatorDeposit != nil {
+			return fmt.Errorf("block %v distributed fees although it collected none", blockNr)
+		}
+		return nil
+	}
+
+	expectedReward, err := utils.ExpectedSystemReward(client, distribution.fees, blockNr)
+	if err != nil {
+		return err
+	}
+	expectedDeposit := new(big.Int).Sub(distribution.fees, expectedReward)
+
+	if expectedReward.Sign() != 0 {
+		if distribution.systemReward == nil || distribution.systemReward.Cmp(expectedReward) != 0 {
+			return fmt.Errorf("block %v sent %v of %v fees to the system reward contract, expected %v", blockNr, distribution.systemReward, distribution.fees, expectedReward)
+		}
+		if distribution.rewardEvent == nil || distribution.rewardEvent.Cmp(expectedReward) != 0 {
+			return fmt.Errorf("receiveDeposit event of block %v has amount %v, expected %v", blockNr, distribution.rewardEvent, expectedReward)
+		}
+	}
+	if distribution.validatorDeposit == nil || distribution.validatorDeposit.Cmp(expectedDeposit) != 0 {
+		return fmt.Errorf("block %v deposited %v of %v fees to the validator set contract, expected %v", blockNr, distribution.validatorDeposit, distribution.fees, expectedDeposit)
+	}
+	// The validator set contract may burn part of the deposit, the rest is credited to the validator
+	deposited := new(big.Int)
+	if distribution.depositEvent != nil {
+		deposited.Add(deposited, distribution.depositEvent)
+	}
+	if distribution.burnEvent != nil {
+		deposited.Add(deposited, distribution.burnEvent)
+	}
+	if distribution.depositEvent == nil || deposited.Cmp(expectedDeposit) != 0 {
+		return fmt.Errorf("deposit events of block %v account for %v (burned %v), expected %v", blockNr, deposited, distribution.burnEvent, expectedDeposit)
+	}
+	return nil
+}
+
+// Sends a transaction paying feePerGas, checks the distribution of its block and the
+// balances with the fee accounting helper. Returns the fees the transaction paid.
+func sendAndVerifyDistribution(tx *types.Transaction) (*big.Int, error) {
+	receipt, err := sendAndWait(tx)
+	if err != nil {
+		return nil, err
+	}
+	effectiveGasPrice, err := utils.EffectiveGasPrice(rpcClient, receipt.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	if effectiveGasPrice.Cmp(feePerGas) != 0 {
+		return nil, fmt.Errorf("effectiveGasPrice is %v, expected %v", effectiveGasPrice, feePerGas)
+	}
+	distribution, err := getFeeDistribution(receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyFeeDistribution(distribution)
+	if err != nil {
+		return nil, err
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	systemTxs, err := verifySystemTxs(receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if systemTxs == 0 {
+		return nil, fmt.Errorf("block %v collected fees but has no system transactions", receipt.BlockNumber)
+	}
+	log.Printf("Block %v: fees = %v, system reward = %v, validator deposit = %v\n", receipt.BlockNumber, distribution.fees, distribution.systemReward, distribution.validatorDeposit)
+	return new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), effectiveGasPrice), nil
+}
+
+// Checks the system transactions of a block: they come after all the other
+// transactions, are free legacy transactions of the miner signed for the chain, and
+// their receipts are successful, have a zero effectiveGasPrice and add their gas to
+// the cumulative gas used of the block like any other transaction. Base fee rules
+// don't apply to them: their gas limit is above the block gas limit and they pay no
+// tip whatever the base fee. Returns the number of system transactions.
+func verifySystemTxs(blockNr *big.Int) (int, error) {
+	block, err := client.BlockByNumber(context.Background(), blockNr)
+	if err != nil {
+		return 0, err
+	}
+	systemTxs := 0
+	var cumulativeGasUsed uint64
+	for i, tx := range block.Transactions() {
+		receipt, err := client.TransactionReceipt(context.Background(), tx.Hash())
+		if err != nil {
+			return 0, err
+		}
+		if receipt.TransactionIndex != uint(i) || receipt.BlockHash != block.Hash() {
+			return 0, fmt.Errorf("receipt of transaction %d of block %v has index %d in block %v", i, blockNr, receipt.TransactionIndex, receipt.BlockHash)
+		}
+		cumulativeGasUsed += receipt.GasUsed
+		if receipt.CumulativeGasUsed != cumulativeGasUsed {
+			return 0, fmt.Errorf("cumulativeGasUsed of transaction %d of block %v is %d, expected %d", i, blockNr, receipt.CumulativeGasUsed, cumulativeGasUsed)
+		}
+
+		systemTx, err := isSystemTx(tx, block.Coinbase())
+		if err != nil {
+			return 0, err
+		}
+		if !systemTx {
+			if systemTxs > 0 {
+				return 0, fmt.Errorf("transaction %v of block %v comes after a system transaction", tx.Hash(), blockNr)
+			}
+			continue
+		}
+		systemTxs++
+
+		if tx.Type() != types.LegacyTxType || receipt.Type != types.LegacyTxType {
+			return 0, fmt.Errorf("system transaction %v of block %v has type %d and receipt type %d, expected %d", tx.Hash(), blockNr, tx.Type(), receipt.Type, types.LegacyTxType)
+		}
+		if !tx.Protected() || tx.ChainId().Cmp(config.ChainId) != 0 {
+			return 0, fmt.Errorf("system transaction %v of block %v is not signed for chain id %v", tx.Hash(), blockNr, config.ChainId)
+		}
+		if tx.Gas() != systemTxGas {
+			return 0, fmt.Errorf("system transaction %v of block %v has gas limit %d, expected %d", tx.Hash(), blockNr, tx.Gas(), uint64(systemTxGas))
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			return 0, fmt.Errorf("system transaction %v of block %v failed. Receipt: %+v", tx.Hash(), blockNr, receipt)
+		}
+		if receipt.GasUsed == 0 {
+			return 0, fmt.Errorf("system transaction %v of block %v used no gas", tx.Hash(), blockNr)
+		}
+		effectiveGasPrice, err := utils.EffectiveGasPrice(rpcClient, tx.Hash())
+		if err != nil {
+			return 0, err
+		}
+		if effectiveGasPrice.Sign() != 0 {
+			return 0, fmt.Errorf("system transaction %v of block %v has effectiveGasPrice %v, expected 0", tx.Hash(), blockNr, effectiveGasPrice)
+		}
+		if block.BaseFee() != nil {
+			if tip := tx.EffectiveGasTipValue(block.BaseFee()); tip.Sign() != 0 {
+				return 0, fmt.Errorf("system transaction %v of block %v pays a tip of %v, expected 0", tx.Hash(), blockNr, tip)
+			}
+		}
+	}
+	if cumulativeGasUsed != block.GasUsed() {
+		return 0, fmt.Errorf("receipts of block %v used %d gas but its header used %d", blockNr, cumulativeGasUsed, block.GasUsed())
+	}
+	return systemTxs, nil
+}
+
+// Fees paid by the pre-Hertz transaction, compared against the post-Hertz one
+var preHertzFees *big.Int
+var preHertzFeesDone = make(chan struct{})
+
+// PRE-HERTZ TEST CASES
+
+func testFeeDistributionPreHertz() error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	fees, err := sendAndVerifyDistribution(types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: feePerGas,
+		Gas:      21000,
+		To:       &receiverAddress,
+		Value:    big.NewInt(1),
+		Data:     []byte{},
+	}))
+	if err != nil {
+		return err
+	}
+	preHertzFees = fees
+	close(preHertzFeesDone)
+	return nil
+}
+
+// POST-HERTZ TEST CASES
+
+// With a zero base fee nothing is burned, so a dynamic fee transaction whose tip is
+// the gas price of the pre-Hertz legacy transaction pays, and distributes, the same fees
+func testFeeDistributionPostHertz() error {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	fees, err := sendAndVerifyDistribution(types.NewTx(&types.DynamicFeeTx{
+		ChainID:   config.ChainId,
+		Nonce:     nonce,
+		GasTipCap: feePerGas,
+		GasFeeCap: new(big.Int).Mul(feePerGas, big.NewInt(2)),
+		Gas:       21000,
+		To:        &receiverAddress,
+		Value:     big.NewInt(1),
+		Data:      []byte{},
+	}))
+	if err != nil {
+		return err
+	}
+	<-preHertzFeesDone
+	if fees.Cmp(preHertzFees) != 0 {
+		return fmt.Errorf("post-Hertz dynamic fee transaction paid %v fees, the pre-Hertz legacy transaction paid %v", fees, preHertzFees)
+	}
+	return nil
+}
+
+// Every block from before the fork to the current one has to distribute its fees the same way
+func testFeeDistributionAcrossFork() error {
+	currentBlock, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	for blockNr := uint64(1); blockNr <= currentBlock; blockNr++ {
+		distribution, err := getFeeDistribution(new(big.Int).SetUint64(blockNr))
+		if err != nil {
+			return err
+		}
+		err = verifyFeeDistribution(distribution)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Verified the fee distribution of blocks 1 to %d\n", currentBlock)
+	return nil
+}
+
+// The system transactions of every block from before the fork to the current one
+// have to be handled the same way
+func testSystemTxsAcrossFork() error {
+	currentBlock, err := client.BlockNumber(context.Background())
+	if err != nil {
+		return err
+	}
+	var preHertzSystemTxs, postHertzSystemTxs int
+	for blockNr := uint64(1); blockNr <= currentBlock; blockNr++ {
+		systemTxs, err := verifySystemTxs(new(big.Int).SetUint64(blockNr))
+		if err != nil {
+			return err
+		}
+		if blockNr < config.HertzBlockNumber {
+			preHertzSystemTxs += systemTxs
+		} else {
+			postHertzSystemTxs += systemTxs
+		}
+	}
+	log.Printf("Verified %d pre-Hertz and %d post-Hertz system transactions in blocks 1 to %d\n", preHertzSystemTxs, postHertzSystemTxs, currentBlock)
+	if preHertzSystemTxs == 0 || postHertzSystemTxs == 0 {
+		return fmt.Errorf("found %d pre-Hertz and %d post-Hertz system transactions, expected some on both sides of the fork", preHertzSystemTxs, postHertzSystemTxs)
+	}
+	return nil
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testFeeDistributionPreHertz",
+			validationFunction: testFeeDistributionPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testFeeDistributionPostHertz",
+			validationFunction: testFeeDistributionPostHertz,
+		},
+		{
+			name:               "testFeeDistributionAcrossFork",
+			validationFunction: testFeeDistributionAcrossFork,
+		},
+		{
+			name:               "testSystemTxsAcrossFork",
+			validationFunction: testSystemTxsAcrossFork,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
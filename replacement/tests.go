@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// How a fee field of the replacement relates to the same field of the original
+type priceLevel int
+
+const (
+	unchanged priceLevel = iota
+	belowBump            // raised, but 1 wei short of the price bump
+	bumped               // raised by exactly the price bump
+)
+
+var priceLevels = []priceLevel{unchanged, belowBump, bumped}
+
+func (level priceLevel) String() string {
+	switch level {
+	case unchanged:
+		return "unchanged"
+	case belowBump:
+		return "below the bump"
+	case bumped:
+		return "bumped"
+	}
+	return fmt.Sprintf("priceLevel(%d)", int(level))
+}
+
+// A transaction that tries to replace an original one with the same nonce. Legacy and
+// access list replacements have a single gas price, which is set by feeCapLevel.
+type ReplacementCase struct {
+	originalType    byte
+	replacementType byte
+	feeCapLevel     priceLevel
+	tipLevel        priceLevel
+}
+
+func (replacementCase ReplacementCase) String() string {
+	if replacementCase.replacementType != types.DynamicFeeTxType {
+		return fmt.Sprintf("type %d replaced by type %d with gas price %v", replacementCase.originalType, replacementCase.replacementType, replacementCase.feeCapLevel)
+	}
+	return fmt.Sprintf("type %d replaced by type %d with fee cap %v and tip %v", replacementCase.originalType, replacementCase.replacementType, replacementCase.feeCapLevel, replacementCase.tipLevel)
+}
+
+// An original transaction and its attempted replacement, which were sent with the same nonce
+type replacementAttempt struct {
+	replacementCase ReplacementCase
+	original        *types.Transaction
+	replacement     *types.Transaction
+	replaced        bool
+}
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var receiverPrivateKey *ecdsa.PrivateKey
+var receiverAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+var txTypes = []byte{types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType}
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	receiverPrivateKey, err = crypto.HexToECDSA(config.ReceiverPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts for the fee accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
+}
+
+// Returns every combination of the given original types, all replacement types and
+// the price levels of the replacement
+func replacementCases(originalTypes []byte) []ReplacementCase {
+	var cases []ReplacementCase
+	for _, originalType := range originalTypes {
+		for _, replacementType := range txTypes {
+			for _, feeCapLevel := range priceLevels {
+				if replacementType != types.DynamicFeeTxType {
+					cases = append(cases, ReplacementCase{originalType, replacementType, feeCapLevel, feeCapLevel})
+					continue
+				}
+				for _, tipLevel := range priceLevels {
+					cases = append(cases, ReplacementCase{originalType, replacementType, feeCapLevel, tipLevel})
+				}
+			}
+		}
+	}
+	return cases
+}
+
+// The minimum a fee field of a replacement must have: old * (100 + price bump) / 100
+func bumpThreshold(old *big.Int) *big.Int {
+	threshold := new(big.Int).Mul(old, big.NewInt(100+config.TxPoolPriceBump))
+	return threshold.Div(threshold, big.NewInt(100))
+}
+
+func applyLevel(level priceLevel, old *big.Int) *big.Int {
+	switch level {
+	case belowBump:
+		return new(big.Int).Sub(bumpThreshold(old), common.Big1)
+	case bumped:
+		return bumpThreshold(old)
+	}
+	return new(big.Int).Set(old)
+}
+
+// A replacement is accepted if both its fee cap and its tip are above the ones of the
+// original and at least at the price bump threshold
+func meetsPriceBump(old, replacement *big.Int) bool {
+	return replacement.Cmp(old) > 0 && replacement.Cmp(bumpThreshold(old)) >= 0
+}
+
+func signTx(txType byte, nonce uint64, gasFeeCap, gasTipCap, value *big.Int) (*types.Transaction, error) {
+	return utils.SignNewTx(txType, utils.TxParams{
+		Nonce:     nonce,
+		GasFeeCap: gasFeeCap,
+		GasTipCap: gasTipCap,
+		Gas:       30000,
+		To:        &receiverAddress,
+		Value:     value,
+		AccessList: types.AccessList{{
+			Address:     receiverAddress,
+			StorageKeys: []common.Hash{{0}},
+		}},
+	}, senderPrivateKey)
+}
+
+// Sends the original transaction of every case and then its replacement, comparing the
+// response to the price bump rule. The originals are queued behind a nonce gap, so
+// that none of them is mined before its replacement is tried. The pool applies the
+// same replacement rule to queued and to executable transactions.
+func sendReplacements(cases []ReplacementCase, hertz bool) (uint64, []replacementAttempt, error) {
+	gapNonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return 0, nil, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return 0, nil, err
+	}
+	// Dynamic fee originals have a tip below their fee cap, so that raising only one
+	// of them is a valid transaction
+	feeCap := new(big.Int).Mul(gasPrice, big.NewInt(2))
+
+	attempts := make([]replacementAttempt, len(cases))
+	for i, replacementCase := range cases {
+		nonce := gapNonce + 1 + uint64(i)
+		tip := feeCap
+		if replacementCase.originalType == types.DynamicFeeTxType {
+			tip = gasPrice
+		}
+		attempts[i].replacementCase = replacementCase
+		attempts[i].original, err = signTx(replacementCase.originalType, nonce, feeCap, tip, big.NewInt(1))
+		if err != nil {
+			return 0, nil, err
+		}
+		err = client.SendTransaction(context.Background(), attempts[i].original)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%v: failed to send the original transaction: %v", replacementCase, err)
+		}
+	}
+
+	for i, replacementCase := range cases {
+		original := attempts[i].original
+		newFeeCap := applyLevel(replacementCase.feeCapLevel, original.GasFeeCap())
+		newTip := newFeeCap
+		if replacementCase.replacementType == types.DynamicFeeTxType {
+			newTip = applyLevel(replacementCase.tipLevel, original.GasTipCap())
+		}
+		attempts[i].replacement, err = signTx(replacementCase.replacementType, original.Nonce(), newFeeCap, newTip, big.NewInt(2))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var expectedErr error
+		switch {
+		case !hertz && replacementCase.replacementType != types.LegacyTxType:
+			expectedErr = types.ErrTxTypeNotSupported
+		case newTip.Cmp(newFeeCap) > 0:
+			// Raising the tip of a legacy original without its fee cap makes the
+			// replacement invalid on its own
+			expectedErr = core.ErrTipAboveFeeCap
+		case !meetsPriceBump(original.GasFeeCap(), newFeeCap) || !meetsPriceBump(original.GasTipCap(), newTip):
+			expectedErr = core.ErrReplaceUnderpriced
+		}
+		err = client.SendTransaction(context.Background(), attempts[i].replacement)
+		if expectedErr == nil {
+			if err != nil {
+				return 0, nil, fmt.Errorf("%v: expected the replacement to be accepted but got '%v' instead", replacementCase, err)
+			}
+			attempts[i].replaced = true
+			continue
+		}
+		err = utils.SentinelError(expectedErr).Match(err)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%v: %v", replacementCase, err)
+		}
+	}
+	return gapNonce, attempts, nil
+}
+
+// Fills the nonce gap and checks that, at every nonce, the replacement is mined if it
+// was accepted and the original otherwise, while the other version is dropped
+func verifyMinedVersions(gapNonce uint64, attempts []replacementAttempt) error {
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return err
+	}
+	gapTx, err := signTx(types.LegacyTxType, gapNonce, gasPrice, gasPrice, big.NewInt(1))
+	if err != nil {
+		return err
+	}
+	err = client.SendTransaction(context.Background(), gapTx)
+	if err != nil {
+		return fmt.Errorf("failed to fill the nonce gap: %v", err)
+	}
+
+	replacedCount := 0
+	for _, attempt := range attempts {
+		mined, dropped := attempt.original, attempt.replacement
+		if attempt.replaced {
+			mined, dropped = attempt.replacement, attempt.original
+			replacedCount++
+		}
+		receipt, err := utils.WaitForTransactionReceipt(client, mined.Hash())
+		if err != nil {
+			return fmt.Errorf("%v: %v", attempt.replacementCase, err)
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("%v: receipt.Status != 1. Receipt: %+v", attempt.replacementCase, receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return fmt.Errorf("%v: %v", attempt.replacementCase, err)
+		}
+		_, _, err = client.TransactionByHash(context.Background(), dropped.Hash())
+		if err != ethereum.NotFound {
+			return fmt.Errorf("%v: expected transaction %v with nonce %d to be dropped, but its lookup returned '%v'", attempt.replacementCase, dropped.Hash(), dropped.Nonce(), err)
+		}
+	}
+	log.Printf("%d of %d replacements were accepted and mined\n", replacedCount, len(attempts))
+	return nil
+}
+
+func runReplacementCases(cases []ReplacementCase, hertz bool) error {
+	gapNonce, attempts, err := sendReplacements(cases, hertz)
+	if err != nil {
+		return err
+	}
+	return verifyMinedVersions(gapNonce, attempts)
+}
+
+// PRE-HERTZ TEST CASES
+
+// Only legacy transactions can be replaced, typed replacements are refused for their type
+func testReplacementsPreHertz() error {
+	return runReplacementCases(replacementCases([]byte{types.LegacyTxType}), false)
+}
+
+// POST-HERTZ TEST CASES
+
+func testReplacementsPostHertz() error {
+	return runReplacementCases(replacementCases(txTypes), true)
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testReplacementsPreHertz",
+			validationFunction: testReplacementsPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testReplacementsPostHertz",
+			validationFunction: testReplacementsPostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
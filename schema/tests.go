@@ -0,0 +1,716 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// Whether a field has to be in a JSON-RPC object
+type presence int
+
+const (
+	required presence = iota
+	optional
+	absent
+)
+
+// A field of a JSON-RPC object and the format of its value. Present fields must not
+// be null unless they are nullable.
+type FieldSchema struct {
+	name     string
+	presence presence
+	format   func(value json.RawMessage) error
+	nullable bool
+}
+
+// A JSON-RPC object as returned by the node, before any decoding
+type rpcObject map[string]json.RawMessage
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var receiverPrivateKey *ecdsa.PrivateKey
+var receiverAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+var txTypes = []byte{types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType}
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	receiverPrivateKey, err = crypto.HexToECDSA(config.ReceiverPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to see the JSON
+	// objects as they are, since ethclient fills in missing fields and drops unknown ones.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
+}
+
+// FORMATS
+
+// A hex encoded quantity without leading zeros
+func quantity(value json.RawMessage) error {
+	var q hexutil.Big
+	return json.Unmarshal(value, &q)
+}
+
+// Hex encoded bytes
+func data(value json.RawMessage) error {
+	var d hexutil.Bytes
+	return json.Unmarshal(value, &d)
+}
+
+func hash(value json.RawMessage) error {
+	var h common.Hash
+	return json.Unmarshal(value, &h)
+}
+
+func address(value json.RawMessage) error {
+	var a common.Address
+	return json.Unmarshal(value, &a)
+}
+
+func boolean(value json.RawMessage) error {
+	var b bool
+	return json.Unmarshal(value, &b)
+}
+
+// A 256 byte bloom filter
+func bloom(value json.RawMessage) error {
+	var b types.Bloom
+	return json.Unmarshal(value, &b)
+}
+
+// An 8 byte block nonce
+func blockNonce(value json.RawMessage) error {
+	var n types.BlockNonce
+	return json.Unmarshal(value, &n)
+}
+
+// An array of hashes
+func hashes(value json.RawMessage) error {
+	var h []common.Hash
+	err := json.Unmarshal(value, &h)
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		return fmt.Errorf("not an array")
+	}
+	return nil
+}
+
+// An array of objects, they are validated against their own schema separately
+func objects(value json.RawMessage) error {
+	var o []rpcObject
+	err := json.Unmarshal(value, &o)
+	if err != nil {
+		return err
+	}
+	if o == nil {
+		return fmt.Errorf("not an array")
+	}
+	return nil
+}
+
+// An array of log objects
+func logs(value json.RawMessage) error {
+	var entries []rpcObject
+	err := json.Unmarshal(value, &entries)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		return fmt.Errorf("not an array")
+	}
+	for i, entry := range entries {
+		if diff := validate(entry, logSchema()); len(diff) > 0 {
+			return fmt.Errorf("log %d: %s", i, strings.Join(diff, ", "))
+		}
+	}
+	return nil
+}
+
+// An array of objects with exactly an address and an array of storage keys
+func accessList(value json.RawMessage) error {
+	var tuples []rpcObject
+	err := json.Unmarshal(value, &tuples)
+	if err != nil {
+		return err
+	}
+	if tuples == nil {
+		return fmt.Errorf("not an array")
+	}
+	tupleSchema := []FieldSchema{
+		{name: "address", presence: required, format: address},
+		{name: "storageKeys", presence: required, format: storageKeys},
+	}
+	for i, tuple := range tuples {
+		if diff := validate(tuple, tupleSchema); len(diff) > 0 {
+			return fmt.Errorf("entry %d: %s", i, strings.Join(diff, ", "))
+		}
+	}
+	return nil
+}
+
+func storageKeys(value json.RawMessage) error {
+	var keys []common.Hash
+	err := json.Unmarshal(value, &keys)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return fmt.Errorf("not an array")
+	}
+	return nil
+}
+
+// SCHEMAS
+
+// Returns the fields of a block with its full transactions. Only blocks since the
+// London fork, which activates with Hertz, have a base fee.
+func blockSchema(hertz bool) []FieldSchema {
+	baseFee := absent
+	if hertz {
+		baseFee = required
+	}
+	return []FieldSchema{
+		{name: "number", presence: required, format: quantity},
+		{name: "hash", presence: required, format: hash},
+		{name: "parentHash", presence: required, format: hash},
+		{name: "nonce", presence: required, format: blockNonce},
+		{name: "mixHash", presence: required, format: hash},
+		{name: "sha3Uncles", presence: required, format: hash},
+		{name: "logsBloom", presence: required, format: bloom},
+		{name: "stateRoot", presence: required, format: hash},
+		{name: "transactionsRoot", presence: required, format: hash},
+		{name: "receiptsRoot", presence: required, format: hash},
+		{name: "miner", presence: required, format: address},
+		{name: "difficulty", presence: required, format: quantity},
+		{name: "totalDifficulty", presence: required, format: quantity},
+		{name: "extraData", presence: required, format: data},
+		{name: "size", presence: required, format: quantity},
+		{name: "gasLimit", presence: required, format: quantity},
+		{name: "gasUsed", presence: required, format: quantity},
+		{name: "timestamp", presence: required, format: quantity},
+		{name: "baseFeePerGas", presence: baseFee, format: quantity},
+		{name: "transactions", presence: required, format: objects},
+		{name: "uncles", presence: required, format: hashes},
+	}
+}
+
+// Returns the fields of a mined transaction of the given type. Typed transactions
+// carry their chain id and access list, and only dynamic fee transactions have the
+// fee cap and tip. yParity duplicates v of typed transactions and isn't reported by
+// every node version, a legacy transaction must not have it. Nodes may report the
+// chain id of legacy transactions.
+func txSchema(txType byte) []FieldSchema {
+	typed, dynamicFee, yParity := absent, absent, absent
+	chainId := optional
+	if txType != types.LegacyTxType {
+		typed, chainId, yParity = required, required, optional
+	}
+	if txType == types.DynamicFeeTxType {
+		dynamicFee = required
+	}
+	return []FieldSchema{
+		{name: "hash", presence: required, format: hash},
+		{name: "blockHash", presence: required, format: hash},
+		{name: "blockNumber", presence: required, format: quantity},
+		{name: "transactionIndex", presence: required, format: quantity},
+		{name: "from", presence: required, format: address},
+		{name: "to", presence: required, format: address, nullable: true},
+		{name: "nonce", presence: required, format: quantity},
+		{name: "gas", presence: required, format: quantity},
+		{name: "gasPrice", presence: required, format: quantity},
+		{name: "value", presence: required, format: quantity},
+		{name: "input", presence: required, format: data},
+		{name: "type", presence: required, format: quantity},
+		{name: "chainId", presence: chainId, format: quantity},
+		{name: "accessList", presence: typed, format: accessList},
+		{name: "maxFeePerGas", presence: dynamicFee, format: quantity},
+		{name: "maxPriorityFeePerGas", presence: dynamicFee, format: quantity},
+		{name: "v", presence: required, format: quantity},
+		{name: "yParity", presence: yParity, format: quantity},
+		{name: "r", presence: required, format: quantity},
+		{name: "s", presence: required, format: quantity},
+	}
+}
+
+// Returns the fields of a receipt. The node reports the type and the effective gas
+// price of receipts before Hertz too, as 0 and the gas price. Since Byzantium
+// receipts have a status instead of the post state root.
+func receiptSchema() []FieldSchema {
+	return []FieldSchema{
+		{name: "transactionHash", presence: required, format: hash},
+		{name: "blockHash", presence: required, format: hash},
+		{name: "blockNumber", presence: required, format: quantity},
+		{name: "transactionIndex", presence: required, format: quantity},
+		{name: "from", presence: required, format: address},
+		{name: "to", presence: required, format: address, nullable: true},
+		{name: "contractAddress", presence: required, format: address, nullable: true},
+		{name: "gasUsed", presence: required, format: quantity},
+		{name: "cumulativeGasUsed", presence: required, format: quantity},
+		{name: "status", presence: required, format: quantity},
+		{name: "root", presence: absent, format: data},
+		{name: "logs", presence: required, format: logs},
+		{name: "logsBloom", presence: required, format: bloom},
+		{name: "type", presence: required, format: quantity},
+		{name: "effectiveGasPrice", presence: required, format: quantity},
+	}
+}
+
+// Returns the fields of a log of a mined transaction
+func logSchema() []FieldSchema {
+	return []FieldSchema{
+		{name: "address", presence: required, format: address},
+		{name: "topics", presence: required, format: hashes},
+		{name: "data", presence: required, format: data},
+		{name: "blockNumber", presence: required, format: quantity},
+		{name: "transactionHash", presence: required, format: hash},
+		{name: "transactionIndex", presence: required, format: quantity},
+		{name: "blockHash", presence: required, format: hash},
+		{name: "logIndex", presence: required, format: quantity},
+		{name: "removed", presence: required, format: boolean},
+	}
+}
+
+// Returns every way object differs from the schema, including fields the schema
+// doesn't know
+func validate(object rpcObject, schema []FieldSchema) []string {
+	var diff []string
+	known := make(map[string]bool, len(schema))
+	for _, field := range schema {
+		known[field.name] = true
+		value, ok := object[field.name]
+		switch {
+		case !ok:
+			if field.presence == required {
+				diff = append(diff, fmt.Sprintf("%s is missing", field.name))
+			}
+		case field.presence == absent:
+			diff = append(diff, fmt.Sprintf("%s must be absent but is %s", field.name, value))
+		case string(value) == "null":
+			if !field.nullable {
+				diff = append(diff, fmt.Sprintf("%s is null", field.name))
+			}
+		default:
+			if err := field.format(value); err != nil {
+				diff = append(diff, fmt.Sprintf("%s is malformed (%s): %v", field.name, value, err))
+			}
+		}
+	}
+	var unknown []string
+	for name := range object {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		diff = append(diff, fmt.Sprintf("%s is not in the schema", name))
+	}
+	return diff
+}
+
+func validateObject(description string, object rpcObject, schema []FieldSchema) error {
+	diff := validate(object, schema)
+	if len(diff) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s doesn't match the schema:\n  %s", description, strings.Join(diff, "\n  "))
+}
+
+// Decodes a field that validated against its schema
+func decodeField(object rpcObject, name string, value interface{}) error {
+	raw, ok := object[name]
+	if !ok {
+		return fmt.Errorf("%s is missing", name)
+	}
+	return json.Unmarshal(raw, value)
+}
+
+func decodeBig(object rpcObject, name string) (*big.Int, error) {
+	var value hexutil.Big
+	err := decodeField(object, name, &value)
+	if err != nil {
+		return nil, err
+	}
+	return value.ToInt(), nil
+}
+
+// Compares the fields of a big number with the expected values
+func compareBigs(object rpcObject, expected map[string]*big.Int) error {
+	for name, expectedValue := range expected {
+		value, err := decodeBig(object, name)
+		if err != nil {
+			return err
+		}
+		if value.Cmp(expectedValue) != 0 {
+			return fmt.Errorf("%s is %v, expected %v", name, value, expectedValue)
+		}
+	}
+	return nil
+}
+
+// RPC CALLS
+
+func getBlock(blockNr uint64) (rpcObject, []rpcObject, error) {
+	var block rpcObject
+	err := rpcClient.CallContext(context.Background(), &block, "eth_getBlockByNumber", hexutil.EncodeUint64(blockNr), true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, fmt.Errorf("block %v not found", blockNr)
+	}
+	var txs []rpcObject
+	err = decodeField(block, "transactions", &txs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transactions of block %v: %v", blockNr, err)
+	}
+	return block, txs, nil
+}
+
+func getObject(method string, txHash common.Hash) (rpcObject, error) {
+	var object rpcObject
+	err := rpcClient.CallContext(context.Background(), &object, method, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, fmt.Errorf("%s returned null for %v", method, txHash)
+	}
+	return object, nil
+}
+
+// Validates a block and all its transactions against the schema of their type
+func verifyBlock(blockNr uint64) (rpcObject, []rpcObject, error) {
+	hertz := blockNr >= config.HertzBlockNumber
+	block, txs, err := getBlock(blockNr)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = validateObject(fmt.Sprintf("block %v", blockNr), block, blockSchema(hertz))
+	if err != nil {
+		return nil, nil, err
+	}
+	if hertz {
+		err = compareBigs(block, map[string]*big.Int{"baseFeePerGas": common.Big0})
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %v: %v", blockNr, err)
+		}
+	}
+	for i, tx := range txs {
+		var txType hexutil.Uint64
+		err = decodeField(tx, "type", &txType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("transaction %d of block %v: type: %v", i, blockNr, err)
+		}
+		if !hertz && txType != types.LegacyTxType {
+			return nil, nil, fmt.Errorf("transaction %d of pre-Hertz block %v has type %d", i, blockNr, txType)
+		}
+		err = validateObject(fmt.Sprintf("transaction %d of block %v", i, blockNr), tx, txSchema(byte(txType)))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return block, txs, nil
+}
+
+// Compares the Hertz-era fields of a transaction object with the sent transaction.
+// The gas price of a mined dynamic fee transaction is its effective gas price.
+func verifyTxValues(object rpcObject, tx *types.Transaction, baseFee *big.Int) error {
+	expected := map[string]*big.Int{
+		"type":     big.NewInt(int64(tx.Type())),
+		"gasPrice": utils.ExpectedEffectiveGasPrice(tx, baseFee),
+	}
+	if tx.Type() != types.LegacyTxType {
+		expected["chainId"] = config.ChainId
+		var accesses types.AccessList
+		err := decodeField(object, "accessList", &accesses)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(accesses, tx.AccessList()) {
+			return fmt.Errorf("accessList is %v, expected %v", accesses, tx.AccessList())
+		}
+		// yParity is optional, but if it is there it must be v
+		if _, ok := object["yParity"]; ok {
+			v, _, _ := tx.RawSignatureValues()
+			expected["yParity"] = v
+		}
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		expected["maxFeePerGas"] = tx.GasFeeCap()
+		expected["maxPriorityFeePerGas"] = tx.GasTipCap()
+	}
+	return compareBigs(object, expected)
+}
+
+func verifyReceiptValues(object rpcObject, tx *types.Transaction, baseFee *big.Int) error {
+	return compareBigs(object, map[string]*big.Int{
+		"type":              big.NewInt(int64(tx.Type())),
+		"status":            common.Big1,
+		"effectiveGasPrice": utils.ExpectedEffectiveGasPrice(tx, baseFee),
+	})
+}
+
+// Sends one transaction of every given type with an access list and a tip below the
+// fee cap, so that every Hertz-era field has a value of its own
+func sendTransactions(txTypes []byte) ([]*types.Transaction, error) {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return nil, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	accesses := types.AccessList{{
+		Address:     receiverAddress,
+		StorageKeys: []common.Hash{{0}, {1}},
+	}}
+	accessListGas := params.TxAccessListAddressGas + 2*params.TxAccessListStorageKeyGas
+	var txs []*types.Transaction
+	for i, txType := range txTypes {
+		p := utils.TxParams{
+			Nonce:     nonce + uint64(i),
+			GasFeeCap: gasPrice,
+			GasTipCap: gasPrice,
+			Gas:       params.TxGas,
+			To:        &receiverAddress,
+			Value:     big.NewInt(1),
+		}
+		if txType != types.LegacyTxType {
+			p.Gas += accessListGas
+			p.AccessList = accesses
+		}
+		if txType == types.DynamicFeeTxType {
+			p.GasFeeCap = new(big.Int).Mul(gasPrice, big.NewInt(2))
+		}
+		signedTx, err := utils.SignNewTx(txType, p, senderPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		err = client.SendTransaction(context.Background(), signedTx)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, signedTx)
+	}
+	return txs, nil
+}
+
+// Sends a transaction of every given type and validates the block it is mined in,
+// the transaction as part of the block and from eth_getTransactionByHash and its
+// receipt against the schema and the sent values
+func verifyTransactions(txTypes []byte) error {
+	txs, err := sendTransactions(txTypes)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		receipt, err := utils.WaitForTransactionReceipt(client, tx.Hash())
+		if err != nil {
+			return err
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return err
+		}
+		blockNr := receipt.BlockNumber.Uint64()
+		description := fmt.Sprintf("transaction of type %d in block %v", tx.Type(), blockNr)
+
+		block, blockTxs, err := verifyBlock(blockNr)
+		if err != nil {
+			return err
+		}
+		var baseFee *big.Int
+		if _, ok := block["baseFeePerGas"]; ok {
+			baseFee, err = decodeBig(block, "baseFeePerGas")
+			if err != nil {
+				return err
+			}
+		}
+		if receipt.TransactionIndex >= uint(len(blockTxs)) {
+			return fmt.Errorf("%s: block has %d transactions, receipt has index %d", description, len(blockTxs), receipt.TransactionIndex)
+		}
+		err = verifyTxValues(blockTxs[receipt.TransactionIndex], tx, baseFee)
+		if err != nil {
+			return fmt.Errorf("%s: eth_getBlockByNumber: %v", description, err)
+		}
+
+		txObject, err := getObject("eth_getTransactionByHash", tx.Hash())
+		if err != nil {
+			return err
+		}
+		err = validateObject(description+" from eth_getTransactionByHash", txObject, txSchema(tx.Type()))
+		if err != nil {
+			return err
+		}
+		err = verifyTxValues(txObject, tx, baseFee)
+		if err != nil {
+			return fmt.Errorf("%s: eth_getTransactionByHash: %v", description, err)
+		}
+
+		receiptObject, err := getObject("eth_getTransactionReceipt", tx.Hash())
+		if err != nil {
+			return err
+		}
+		err = validateObject("receipt of the "+description, receiptObject, receiptSchema())
+		if err != nil {
+			return err
+		}
+		err = verifyReceiptValues(receiptObject, tx, baseFee)
+		if err != nil {
+			return fmt.Errorf("receipt of the %s: %v", description, err)
+		}
+	}
+	log.Printf("The JSON-RPC objects of %d transactions match the schema\n", len(txs))
+	return nil
+}
+
+// PRE-HERTZ TEST CASES
+
+// Only legacy transactions can be sent before Hertz
+func testLegacyTxSchemaPreHertz() error {
+	return verifyTransactions([]byte{types.LegacyTxType})
+}
+
+// POST-HERTZ TEST CASES
+
+func testTxSchemaPostHertz() error {
+	return verifyTransactions(txTypes)
+}
+
+// Validates every block up to the post-Hertz block. The headers of old blocks are
+// kept by every node, so the pre-Hertz blocks can be checked after the fork too.
+func testBlockSchemaAcrossHertzPostHertz() error {
+	for blockNr := uint64(1); blockNr <= config.PostHertzBlockNumber; blockNr++ {
+		_, _, err := verifyBlock(blockNr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testLegacyTxSchemaPreHertz",
+			validationFunction: testLegacyTxSchemaPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testTxSchemaPostHertz",
+			validationFunction: testTxSchemaPostHertz,
+		},
+		{
+			name:               "testBlockSchemaAcrossHertzPostHertz",
+			validationFunction: testBlockSchemaAcrossHertzPostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// A transaction of the sender signed in one way and the error the node must return
+// for it. expectedErr returns nil if the transaction has to be accepted.
+type SignerCase struct {
+	name   string
+	txType byte
+	// Chain id of the transaction, config.ChainId if nil
+	chainId *big.Int
+	// Signs the transaction, signs it for config.ChainId if nil
+	sign func(tx *types.Transaction) (*types.Transaction, error)
+	// Changes the signature values of the signed transaction if set
+	tamper      func(txType byte, v, r, s *big.Int) (*big.Int, *big.Int, *big.Int)
+	expectedErr func(hertz bool) error
+}
+
+// The transaction fields eth_getTransactionByHash reports about the signature
+type rpcSignature struct {
+	Type    hexutil.Uint64  `json:"type"`
+	From    common.Address  `json:"from"`
+	ChainID *hexutil.Big    `json:"chainId"`
+	YParity *hexutil.Uint64 `json:"yParity"`
+	V       *hexutil.Big    `json:"v"`
+	R       *hexutil.Big    `json:"r"`
+	S       *hexutil.Big    `json:"s"`
+}
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var receiverPrivateKey *ecdsa.PrivateKey
+var receiverAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+var wrongChainId = new(big.Int).Add(config.ChainId, common.Big1)
+
+// Order of the secp256k1 curve, s and n - s are both valid for the same signature
+var secp256k1N = crypto.S256().Params().N
+
+// Returned by eth_sendRawTransaction for legacy transactions without a chain id
+// unless the node runs with --rpc.allow-unprotected-txs
+var errUnprotected = errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	receiverPrivateKey, err = crypto.HexToECDSA(config.ReceiverPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// signature fields of eth_getTransactionByHash.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
+}
+
+func always(err error) func(hertz bool) error {
+	return func(hertz bool) error {
+		return err
+	}
+}
+
+// A valid typed transaction is only refused for its type before Hertz
+func typedValid(hertz bool) error {
+	if hertz {
+		return nil
+	}
+	return types.ErrTxTypeNotSupported
+}
+
+// Unprotected transactions are refused over RPC before the pool sees them, unless
+// the node allows them
+func unprotected(expectedErr func(hertz bool) error) func(hertz bool) error {
+	return func(hertz bool) error {
+		if !config.RPCAllowUnprotectedTxs {
+			return errUnprotected
+		}
+		return expectedErr(hertz)
+	}
+}
+
+func signWith(signer types.Signer) func(tx *types.Transaction) (*types.Transaction, error) {
+	return func(tx *types.Transaction) (*types.Transaction, error) {
+		return types.SignTx(tx, signer, senderPrivateKey)
+	}
+}
+
+// Signs a dynamic fee transaction with the hash the Berlin signer uses for an access
+// list transaction with the same fields. The signature is valid, but the node
+// recovers it over the London hash, which gives some other account.
+func signBerlinHash(tx *types.Transaction) (*types.Transaction, error) {
+	berlinTx := types.NewTx(&types.AccessListTx{
+		ChainID:    tx.ChainId(),
+		Nonce:      tx.Nonce(),
+		GasPrice:   tx.GasFeeCap(),
+		Gas:        tx.Gas(),
+		To:         tx.To(),
+		Value:      tx.Value(),
+		Data:       tx.Data(),
+		AccessList: tx.AccessList(),
+	})
+	sig, err := crypto.Sign(types.NewEIP2930Signer(config.ChainId).Hash(berlinTx).Bytes(), senderPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.NewLondonSigner(config.ChainId)
+	signedTx, err := tx.WithSignature(signer, sig)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := types.Sender(signer, signedTx)
+	if err != nil {
+		return nil, err
+	}
+	if sender == senderAddress {
+		return nil, fmt.Errorf("the London signer recovers the sender from a signature over the Berlin hash")
+	}
+	return signedTx, nil
+}
+
+// Replaces v with a fixed value
+func withV(value *big.Int) func(txType byte, v, r, s *big.Int) (*big.Int, *big.Int, *big.Int) {
+	return func(txType byte, v, r, s *big.Int) (*big.Int, *big.Int, *big.Int) {
+		return value, r, s
+	}
+}
+
+// Replaces s with n - s and flips the recovery id, which recovers the same key but
+// is refused since Homestead to prevent malleability. The recovery id of typed
+// transactions is v, the one of legacy transactions is 0 for odd and 1 for even v.
+func highS(txType byte, v, r, s *big.Int) (*big.Int, *big.Int, *big.Int) {
+	recoveryId := v.Bit(0)
+	if txType == types.LegacyTxType {
+		recoveryId ^= 1
+	}
+	if recoveryId == 0 {
+		v = new(big.Int).Add(v, common.Big1)
+	} else {
+		v = new(big.Int).Sub(v, common.Big1)
+	}
+	return v, r, new(big.Int).Sub(secp256k1N, s)
+}
+
+// v of an EIP-155 transaction of the node's chain with the given recovery id
+func protectedV(recoveryId int64) *big.Int {
+	v := new(big.Int).Mul(config.ChainId, big.NewInt(2))
+	return v.Add(v, big.NewInt(35+recoveryId))
+}
+
+var signerCases = []SignerCase{
+	{
+		name:        "EIP-155 legacy transaction",
+		txType:      types.LegacyTxType,
+		expectedErr: always(nil),
+	},
+	{
+		name:        "unprotected legacy transaction",
+		txType:      types.LegacyTxType,
+		sign:        signWith(types.HomesteadSigner{}),
+		expectedErr: unprotected(always(nil)),
+	},
+	{
+		name:        "access list transaction",
+		txType:      types.AccessListTxType,
+		expectedErr: typedValid,
+	},
+	{
+		name:        "dynamic fee transaction",
+		txType:      types.DynamicFeeTxType,
+		expectedErr: typedValid,
+	},
+	{
+		// The pool recovers the sender before it checks the type, so signature errors
+		// of typed transactions are the same before and after Hertz
+		name:        "EIP-155 legacy transaction with wrong chain id",
+		txType:      types.LegacyTxType,
+		sign:        signWith(types.NewEIP155Signer(wrongChainId)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "access list transaction with wrong chain id",
+		txType:      types.AccessListTxType,
+		chainId:     wrongChainId,
+		sign:        signWith(types.NewLondonSigner(wrongChainId)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "dynamic fee transaction with wrong chain id",
+		txType:      types.DynamicFeeTxType,
+		chainId:     wrongChainId,
+		sign:        signWith(types.NewLondonSigner(wrongChainId)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		// The funds of the recovered account are checked after the type
+		name:   "dynamic fee transaction signed over the Berlin hash",
+		txType: types.DynamicFeeTxType,
+		sign:   signBerlinHash,
+		expectedErr: func(hertz bool) error {
+			if hertz {
+				return core.ErrInsufficientFunds
+			}
+			return types.ErrTxTypeNotSupported
+		},
+	},
+	{
+		name:        "access list transaction with yParity 2",
+		txType:      types.AccessListTxType,
+		tamper:      withV(big.NewInt(2)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "dynamic fee transaction with yParity 2",
+		txType:      types.DynamicFeeTxType,
+		tamper:      withV(big.NewInt(2)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "dynamic fee transaction with v 27",
+		txType:      types.DynamicFeeTxType,
+		tamper:      withV(big.NewInt(27)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "dynamic fee transaction with EIP-155 v",
+		txType:      types.DynamicFeeTxType,
+		tamper:      withV(protectedV(0)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		// v 29 counts as protected, for a chain id that doesn't match the node's
+		name:        "legacy transaction with v 29",
+		txType:      types.LegacyTxType,
+		tamper:      withV(big.NewInt(29)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "EIP-155 legacy transaction with recovery id 2",
+		txType:      types.LegacyTxType,
+		tamper:      withV(protectedV(2)),
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "EIP-155 legacy transaction with high s",
+		txType:      types.LegacyTxType,
+		tamper:      highS,
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "unprotected legacy transaction with high s",
+		txType:      types.LegacyTxType,
+		sign:        signWith(types.HomesteadSigner{}),
+		tamper:      highS,
+		expectedErr: unprotected(always(core.ErrInvalidSender)),
+	},
+	{
+		name:        "access list transaction with high s",
+		txType:      types.AccessListTxType,
+		tamper:      highS,
+		expectedErr: always(core.ErrInvalidSender),
+	},
+	{
+		name:        "dynamic fee transaction with high s",
+		txType:      types.DynamicFeeTxType,
+		tamper:      highS,
+		expectedErr: always(core.ErrInvalidSender),
+	},
+}
+
+// Returns an unsigned transfer of 1 wei to receiverAddress without access list
+func newTx(txType byte, chainId *big.Int, nonce uint64, gasPrice *big.Int) (*types.Transaction, error) {
+	return utils.NewTx(txType, utils.TxParams{
+		ChainID:   chainId,
+		Nonce:     nonce,
+		GasFeeCap: gasPrice,
+		GasTipCap: gasPrice,
+		Gas:       params.TxGas,
+		To:        &receiverAddress,
+		Value:     big.NewInt(1),
+	})
+}
+
+// Returns a copy of tx with the given signature values, which may be ones no signer
+// would produce
+func withSignatureValues(tx *types.Transaction, v, r, s *big.Int) (*types.Transaction, error) {
+	switch tx.Type() {
+	case types.LegacyTxType:
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: tx.GasPrice(),
+			Gas:      tx.Gas(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Data:     tx.Data(),
+			V:        v,
+			R:        r,
+			S:        s,
+		}), nil
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      tx.Nonce(),
+			GasPrice:   tx.GasPrice(),
+			Gas:        tx.Gas(),
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+			V:          v,
+			R:          r,
+			S:          s,
+		}), nil
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      tx.Nonce(),
+			GasFeeCap:  tx.GasFeeCap(),
+			GasTipCap:  tx.GasTipCap(),
+			Gas:        tx.Gas(),
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+			V:          v,
+			R:          r,
+			S:          s,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown transaction type %d", tx.Type())
+}
+
+func signCase(signerCase SignerCase, nonce uint64, gasPrice *big.Int) (*types.Transaction, error) {
+	chainId := signerCase.chainId
+	if chainId == nil {
+		chainId = config.ChainId
+	}
+	tx, err := newTx(signerCase.txType, chainId, nonce, gasPrice)
+	if err != nil {
+		return nil, err
+	}
+	sign := signerCase.sign
+	if sign == nil {
+		sign = signWith(types.LatestSignerForChainID(config.ChainId))
+	}
+	signedTx, err := sign(tx)
+	if err != nil {
+		return nil, err
+	}
+	if signerCase.tamper == nil {
+		return signedTx, nil
+	}
+	v, r, s := signedTx.RawSignatureValues()
+	v, r, s = signerCase.tamper(signedTx.Type(), v, r, s)
+	return withSignatureValues(signedTx, v, r, s)
+}
+
+// Checks that eth_getTransactionByHash reports the signature of a mined transaction
+// as it was sent. Typed transactions have a chain id and a v of 0 or 1, which
+// yParity must equal if the node reports it. Legacy transactions have no yParity and
+// only EIP-155 ones have the chain id encoded in v.
+func verifyRPCSignature(tx *types.Transaction) error {
+	var rpcTx *rpcSignature
+	err := rpcClient.CallContext(context.Background(), &rpcTx, "eth_getTransactionByHash", tx.Hash())
+	if err != nil {
+		return err
+	}
+	if rpcTx == nil {
+		return fmt.Errorf("transaction %v not found", tx.Hash())
+	}
+	if uint64(rpcTx.Type) != uint64(tx.Type()) {
+		return fmt.Errorf("type is %d, expected %d", rpcTx.Type, tx.Type())
+	}
+	if rpcTx.From != senderAddress {
+		return fmt.Errorf("from is %v, expected %v", rpcTx.From, senderAddress)
+	}
+	if rpcTx.V == nil || rpcTx.R == nil || rpcTx.S == nil {
+		return fmt.Errorf("signature values are missing: %+v", rpcTx)
+	}
+	v, r, s := tx.RawSignatureValues()
+	if rpcTx.V.ToInt().Cmp(v) != 0 || rpcTx.R.ToInt().Cmp(r) != 0 || rpcTx.S.ToInt().Cmp(s) != 0 {
+		return fmt.Errorf("signature values are v %v, r %v, s %v, expected v %v, r %v, s %v", rpcTx.V, rpcTx.R, rpcTx.S, v, r, s)
+	}
+
+	if tx.Type() != types.LegacyTxType {
+		if rpcTx.ChainID == nil || rpcTx.ChainID.ToInt().Cmp(config.ChainId) != 0 {
+			return fmt.Errorf("chainId is %v, expected %v", rpcTx.ChainID, config.ChainId)
+		}
+		if v.Cmp(common.Big1) > 0 {
+			return fmt.Errorf("v is %v, expected 0 or 1", v)
+		}
+		if rpcTx.YParity != nil && uint64(*rpcTx.YParity) != v.Uint64() {
+			return fmt.Errorf("yParity is %d, but v is %v", *rpcTx.YParity, v)
+		}
+		return nil
+	}
+
+	if rpcTx.YParity != nil {
+		return fmt.Errorf("legacy transaction has yParity %d", *rpcTx.YParity)
+	}
+	if tx.Protected() {
+		if v.Cmp(protectedV(0)) != 0 && v.Cmp(protectedV(1)) != 0 {
+			return fmt.Errorf("v is %v, expected %v or %v", v, protectedV(0), protectedV(1))
+		}
+		if rpcTx.ChainID != nil && rpcTx.ChainID.ToInt().Cmp(config.ChainId) != 0 {
+			return fmt.Errorf("chainId is %v, expected %v", rpcTx.ChainID, config.ChainId)
+		}
+		return nil
+	}
+	if v.Cmp(big.NewInt(27)) != 0 && v.Cmp(big.NewInt(28)) != 0 {
+		return fmt.Errorf("v is %v, expected 27 or 28", v)
+	}
+	if rpcTx.ChainID != nil {
+		return fmt.Errorf("unprotected transaction has chainId %v", rpcTx.ChainID)
+	}
+	return nil
+}
+
+// Sends every signer case and compares the error returned by eth_sendRawTransaction
+// with the expected one. Accepted transactions are waited for and their signature
+// is checked against eth_getTransactionByHash.
+func runSignerCases(hertz bool) error {
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return err
+	}
+	accepted := 0
+	for _, signerCase := range signerCases {
+		nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+		if err != nil {
+			return err
+		}
+		tx, err := signCase(signerCase, nonce, gasPrice)
+		if err != nil {
+			return fmt.Errorf("%s: %v", signerCase.name, err)
+		}
+
+		expectedErr := signerCase.expectedErr(hertz)
+		err = client.SendTransaction(context.Background(), tx)
+		if expectedErr != nil {
+			err = utils.SentinelError(expectedErr).Match(err)
+			if err != nil {
+				return fmt.Errorf("%s: %v", signerCase.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: expected no error but got '%v' instead", signerCase.name, err)
+		}
+		receipt, err := utils.WaitForTransactionReceipt(client, tx.Hash())
+		if err != nil {
+			return err
+		}
+		if receipt.Status != 1 {
+			return fmt.Errorf("%s: receipt.Status != 1. Receipt: %+v", signerCase.name, receipt)
+		}
+		err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+		if err != nil {
+			return fmt.Errorf("%s: %v", signerCase.name, err)
+		}
+		err = verifyRPCSignature(tx)
+		if err != nil {
+			return fmt.Errorf("%s: eth_getTransactionByHash: %v", signerCase.name, err)
+		}
+		accepted++
+	}
+	log.Printf("Signer errors are as expected, %d transactions were mined\n", accepted)
+	return nil
+}
+
+// PRE-HERTZ TEST CASES
+
+func testSignerCasesPreHertz() error {
+	return runSignerCases(false)
+}
+
+// POST-HERTZ TEST CASES
+
+func testSignerCasesPostHertz() error {
+	return runSignerCases(true)
+}
+
+// The Berlin signer can't sign dynamic fee transactions, the London one can
+func testBerlinSignerDynamicFeeTxPostHertz() error {
+	tx, err := newTx(types.DynamicFeeTxType, config.ChainId, 0, config.MinerGasPrice)
+	if err != nil {
+		return err
+	}
+	_, err = types.SignTx(tx, types.NewEIP2930Signer(config.ChainId), senderPrivateKey)
+	if !errors.Is(err, types.ErrTxTypeNotSupported) {
+		return fmt.Errorf("expected error '%v' from the Berlin signer but got '%v' instead", types.ErrTxTypeNotSupported, err)
+	}
+	signedTx, err := types.SignTx(tx, types.NewLondonSigner(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return err
+	}
+	sender, err := types.Sender(types.NewLondonSigner(config.ChainId), signedTx)
+	if err != nil {
+		return err
+	}
+	if sender != senderAddress {
+		return fmt.Errorf("London signer recovered %v, expected %v", sender, senderAddress)
+	}
+	return nil
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testSignerCasesPreHertz",
+			validationFunction: testSignerCasesPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testSignerCasesPostHertz",
+			validationFunction: testSignerCasesPostHertz,
+		},
+		{
+			name:               "testBerlinSignerDynamicFeeTxPostHertz",
+			validationFunction: testBerlinSignerDynamicFeeTxPostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
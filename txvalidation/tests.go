@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+
+	"hertzTests/config"
+	"hertzTests/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type TestCase struct {
+	name               string       // name of the test
+	validationFunction func() error // if error is nil validation is successful
+}
+
+// The fields of a transaction to receiverAddress and the key that signs it
+type txParams struct {
+	utils.TxParams
+	key *ecdsa.PrivateKey
+}
+
+// A transaction that is made invalid in one way and the error the node must return
+// for it. expectedErr returns nil if the transaction has to be accepted.
+type ValidationCase struct {
+	name        string
+	modify      func(txType byte, p *txParams)
+	expectedErr func(txType byte) error
+	// A valid transaction with the same nonce is sent first, so the case replaces it
+	replacesPending bool
+	// The transaction leaves a nonce gap, it is queued until the gap is filled
+	futureNonce bool
+}
+
+var senderPrivateKey *ecdsa.PrivateKey
+var senderAddress common.Address
+var receiverPrivateKey *ecdsa.PrivateKey
+var receiverAddress common.Address
+var rpcClient *rpc.Client
+var client *ethclient.Client
+var err error
+
+var txTypes = []byte{types.LegacyTxType, types.AccessListTxType, types.DynamicFeeTxType}
+
+// A fresh account funded with poorBalance, enough to pay 30 000 gas at the miner gas
+// price but not at twice that price
+var poorPrivateKey *ecdsa.PrivateKey
+var poorBalance = new(big.Int).Mul(config.MinerGasPrice, big.NewInt(30_000))
+
+// Gas limit of the latest block when the matrix starts
+var blockGasLimit uint64
+
+// 2^256, one bit more than fee fields can have
+var tooLargeFee = new(big.Int).Lsh(common.Big1, 256)
+
+func init() {
+	senderPrivateKey, err = crypto.HexToECDSA(config.SenderPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	receiverPrivateKey, err = crypto.HexToECDSA(config.ReceiverPrivateKeyHex)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to an Ethereum client. The raw RPC client is needed to read the
+	// effectiveGasPrice of receipts for the fee accounting checks.
+	rpcClient, err = rpc.Dial("http://localhost:8545")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client = ethclient.NewClient(rpcClient)
+
+	senderAddress = crypto.PubkeyToAddress(senderPrivateKey.PublicKey)
+	receiverAddress = crypto.PubkeyToAddress(receiverPrivateKey.PublicKey)
+}
+
+func always(err error) func(txType byte) error {
+	return func(txType byte) error {
+		return err
+	}
+}
+
+// core.ErrFeeCapTooLow and core.ErrNonceTooHigh are only returned when a transaction
+// is applied in a block, the pool never returns them for a transaction sent over RPC.
+// The matrix doesn't cover them, the rows with a zero fee cap and a future nonce check
+// what the pool does instead.
+var validationCases = []ValidationCase{
+	{
+		name:        "valid transaction",
+		modify:      func(txType byte, p *txParams) {},
+		expectedErr: always(nil),
+	},
+	{
+		// The pool doesn't check the fee cap against the base fee, and with a zero base
+		// fee ErrFeeCapTooLow can't happen in a block either. Local transactions are
+		// also exempt from the minimum gas price of the pool.
+		name: "zero fee cap is accepted and mined",
+		modify: func(txType byte, p *txParams) {
+			p.GasFeeCap = big.NewInt(0)
+			p.GasTipCap = big.NewInt(0)
+		},
+		expectedErr: always(nil),
+	},
+	{
+		// The matrix starts with a mined transaction of the sender, so nonce 0 is used
+		name: "nonce too low",
+		modify: func(txType byte, p *txParams) {
+			p.Nonce = 0
+		},
+		expectedErr: always(core.ErrNonceTooLow),
+	},
+	{
+		// The pool queues transactions with a future nonce until the gap is filled
+		name: "future nonce is queued then promoted",
+		modify: func(txType byte, p *txParams) {
+			p.Nonce++
+		},
+		expectedErr: always(nil),
+		futureNonce: true,
+	},
+	{
+		name: "gas below intrinsic gas",
+		modify: func(txType byte, p *txParams) {
+			p.Gas--
+		},
+		expectedErr: always(core.ErrIntrinsicGas),
+	},
+	{
+		name: "gas above block gas limit",
+		modify: func(txType byte, p *txParams) {
+			p.Gas = 2 * blockGasLimit
+		},
+		expectedErr: always(core.ErrGasLimit),
+	},
+	{
+		// The pool requires value + gasFeeCap * gas, although with a zero base fee the
+		// transaction would only pay gasTipCap * gas
+		name: "insufficient funds for fee cap times gas",
+		modify: func(txType byte, p *txParams) {
+			p.key = poorPrivateKey
+			p.Nonce = 0
+			p.GasFeeCap = new(big.Int).Mul(config.MinerGasPrice, big.NewInt(2))
+			p.GasTipCap = config.MinerGasPrice
+			p.Value = big.NewInt(0)
+		},
+		expectedErr: always(core.ErrInsufficientFunds),
+	},
+	{
+		// The fee fields above 256 bits are sent without gas, so that the fee stays below
+		// the --rpc.txfeecap of the node, which is checked before the pool
+		name: "fee cap above 256 bits",
+		modify: func(txType byte, p *txParams) {
+			p.GasFeeCap = tooLargeFee
+			p.GasTipCap = big.NewInt(1)
+			p.Gas = 0
+		},
+		expectedErr: always(core.ErrFeeCapVeryHigh),
+	},
+	{
+		// Legacy and access list transactions have a single gas price, which is checked
+		// as the fee cap first
+		name: "tip above 256 bits",
+		modify: func(txType byte, p *txParams) {
+			p.GasTipCap = tooLargeFee
+			if txType != types.DynamicFeeTxType {
+				p.GasFeeCap = tooLargeFee
+			}
+			p.Gas = 0
+		},
+		expectedErr: func(txType byte) error {
+			if txType == types.DynamicFeeTxType {
+				return core.ErrTipVeryHigh
+			}
+			return core.ErrFeeCapVeryHigh
+		},
+	},
+	{
+		// Only dynamic fee transactions can have a tip above their fee cap
+		name: "tip above fee cap",
+		modify: func(txType byte, p *txParams) {
+			p.GasTipCap = new(big.Int).Add(p.GasFeeCap, common.Big1)
+		},
+		expectedErr: func(txType byte) error {
+			if txType == types.DynamicFeeTxType {
+				return core.ErrTipAboveFeeCap
+			}
+			return nil
+		},
+	},
+	{
+		name: "replacement without price bump",
+		modify: func(txType byte, p *txParams) {
+			p.Value = big.NewInt(2)
+		},
+		expectedErr:     always(core.ErrReplaceUnderpriced),
+		replacesPending: true,
+	},
+}
+
+// Returns the intrinsic gas of a transaction to an account without data
+func intrinsicGas(txType byte) uint64 {
+	if txType == types.LegacyTxType {
+		return params.TxGas
+	}
+	return params.TxGas + params.TxAccessListAddressGas + params.TxAccessListStorageKeyGas
+}
+
+// Returns the fields of a valid transaction of the sender with the next nonce
+func validTxParams(txType byte) (txParams, error) {
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return txParams{}, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return txParams{}, err
+	}
+	return txParams{
+		TxParams: utils.TxParams{
+			Nonce:     nonce,
+			GasFeeCap: gasPrice,
+			GasTipCap: gasPrice,
+			Gas:       intrinsicGas(txType),
+			To:        &receiverAddress,
+			Value:     big.NewInt(1),
+			AccessList: types.AccessList{{
+				Address:     receiverAddress,
+				StorageKeys: []common.Hash{{0}},
+			}},
+		},
+		key: senderPrivateKey,
+	}, nil
+}
+
+func signTx(txType byte, p txParams) (*types.Transaction, error) {
+	return utils.SignNewTx(txType, p.TxParams, p.key)
+}
+
+func signAndSend(txType byte, p txParams) (common.Hash, error) {
+	tx, err := signTx(txType, p)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), client.SendTransaction(context.Background(), tx)
+}
+
+// Funds a fresh poor account and reads the block gas limit, after that the sender has
+// a mined transaction
+func setUpValidationMatrix() error {
+	poorPrivateKey, err = crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+	nonce, err := client.PendingNonceAt(context.Background(), senderAddress)
+	if err != nil {
+		return err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return err
+	}
+	poorAddress := crypto.PubkeyToAddress(poorPrivateKey.PublicKey)
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      params.TxGas,
+		To:       &poorAddress,
+		Value:    poorBalance,
+	}), types.LatestSignerForChainID(config.ChainId), senderPrivateKey)
+	if err != nil {
+		return err
+	}
+	err = client.SendTransaction(context.Background(), tx)
+	if err != nil {
+		return err
+	}
+	receipt, err := utils.WaitForTransactionReceipt(client, tx.Hash())
+	if err != nil {
+		return err
+	}
+	if receipt.Status != 1 {
+		return fmt.Errorf("funding of the poor account failed. Receipt: %+v", receipt)
+	}
+	err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+	if err != nil {
+		return err
+	}
+
+	header, err := client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	blockGasLimit = header.GasLimit
+	return nil
+}
+
+// Sends every validation case as every transaction type and compares the error
+// returned by eth_sendRawTransaction with the expected one. Before Hertz every typed
+// transaction is refused for its type before any other check. The accepted
+// transactions of a type are waited for before moving to the next type.
+func runValidationMatrix(hertz bool) error {
+	err := setUpValidationMatrix()
+	if err != nil {
+		return err
+	}
+	for _, txType := range txTypes {
+		supported := hertz || txType == types.LegacyTxType
+		var accepted []common.Hash
+		for _, validationCase := range validationCases {
+			name := fmt.Sprintf("%s as type %d", validationCase.name, txType)
+			p, err := validTxParams(txType)
+			if err != nil {
+				return err
+			}
+			if validationCase.replacesPending && supported {
+				txHash, err := signAndSend(txType, p)
+				if err != nil {
+					return fmt.Errorf("%s: failed to send the pending transaction: %v", name, err)
+				}
+				accepted = append(accepted, txHash)
+			}
+			validationCase.modify(txType, &p)
+
+			expectedErr := validationCase.expectedErr(txType)
+			if !supported {
+				expectedErr = types.ErrTxTypeNotSupported
+			}
+			txHash, err := signAndSend(txType, p)
+			if expectedErr == nil {
+				if err != nil {
+					return fmt.Errorf("%s: expected no error but got '%v' instead", name, err)
+				}
+				accepted = append(accepted, txHash)
+			} else {
+				err = utils.SentinelError(expectedErr).Match(err)
+				if err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+			}
+
+			if validationCase.futureNonce && expectedErr == nil {
+				// Fill the nonce gap, which promotes the queued transaction
+				gapParams, err := validTxParams(txType)
+				if err != nil {
+					return err
+				}
+				if gapParams.Nonce != p.Nonce-1 {
+					return fmt.Errorf("%s: pending nonce is %d with a queued transaction, expected %d", name, gapParams.Nonce, p.Nonce-1)
+				}
+				txHash, err := signAndSend(txType, gapParams)
+				if err != nil {
+					return fmt.Errorf("%s: failed to fill the nonce gap: %v", name, err)
+				}
+				accepted = append(accepted, txHash)
+			}
+		}
+
+		for _, txHash := range accepted {
+			receipt, err := utils.WaitForTransactionReceipt(client, txHash)
+			if err != nil {
+				return err
+			}
+			if receipt.Status != 1 {
+				return fmt.Errorf("receipt.Status != 1. Receipt: %+v", receipt)
+			}
+			err = utils.VerifyFeeAccounting(rpcClient, receipt.TxHash)
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("Validation errors of transaction type %d are as expected, %d transactions were mined\n", txType, len(accepted))
+	}
+	return nil
+}
+
+// PRE-HERTZ TEST CASES
+
+func testValidationMatrixPreHertz() error {
+	return runValidationMatrix(false)
+}
+
+// POST-HERTZ TEST CASES
+
+func testValidationMatrixPostHertz() error {
+	return runValidationMatrix(true)
+}
+
+// Runs the slice of test cases sequentially
+func runTestCasesSequentially(testCases []TestCase) {
+	for _, testCase := range testCases {
+		err := testCase.validationFunction()
+		if err != nil {
+			log.Fatal(testCase.name, " FAILED: ", err)
+		}
+	}
+}
+
+func runPreHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testValidationMatrixPreHertz",
+			validationFunction: testValidationMatrixPreHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func runPostHertzTests() {
+	testCases := []TestCase{
+		{
+			name:               "testValidationMatrixPostHertz",
+			validationFunction: testValidationMatrixPostHertz,
+		},
+	}
+	runTestCasesSequentially(testCases)
+}
+
+func preHertzTests() {
+	log.Println("Pre-Hertz tests:")
+	blockNr, err := client.BlockNumber(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if blockNr >= config.PostHertzBlockNumber {
+		log.Fatalf("Too late to run pre-Hertz tests since current block number %v is after Hertz hard fork block %v.\n", blockNr, config.PostHertzBlockNumber)
+	}
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PreHertzBlockNumber)
+	err = utils.WaitForBlockNumber(client, config.PreHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runPreHertzTests()
+	log.Println("All Pre-Hertz tests passed!")
+}
+
+func postHertzTests() {
+	log.Println("Post-Hertz tests:")
+	log.Printf("Waiting for block number %v to start running the test cases...\n", config.PostHertzBlockNumber)
+	err := utils.WaitForBlockNumber(client, config.PostHertzBlockNumber)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Block number %v reached, running test cases....\n", config.PostHertzBlockNumber)
+	runPostHertzTests()
+	log.Println("All Post-Hertz tests passed!")
+}
+
+func main() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		preHertzTests()
+	}()
+	go func() {
+		defer wg.Done()
+		postHertzTests()
+	}()
+	wg.Wait()
+	fmt.Println("ALL TESTS PASSED!")
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// JSON-RPC error codes returned by the node
+const (
+	// Code of errors that don't have a code of their own, e.g. the txpool errors
+	DefaultErrorCode = -32000
+	// Code of eth_call and eth_estimateGas errors that carry revert data
+	RevertErrorCode = 3
+)
+
+// MatchMode tells how the message of an error is compared to the expected one
+type MatchMode int
+
+const (
+	MatchExact MatchMode = iota
+	MatchPrefix
+)
+
+func (mode MatchMode) String() string {
+	switch mode {
+	case MatchExact:
+		return "exactly"
+	case MatchPrefix:
+		return "with prefix"
+	}
+	return fmt.Sprintf("MatchMode(%d)", int(mode))
+}
+
+// ExpectedError describes the error a call to the node must fail with. Code and Data
+// are only checked if they are set. Data is the hex encoded payload of an
+// rpc.DataError, e.g. the revert data of eth_call.
+type ExpectedError struct {
+	Code    int
+	Message string
+	Mode    MatchMode
+	Data    string
+}
+
+// Expects the message of a sentinel error of the node, e.g. core.ErrNonceTooLow, which
+// reaches the client with the default error code. The node wraps some of them with
+// details, e.g. "nonce too low: address ..., tx: 0 state: 1", so any message
+// starting with it matches. A prefix rather than a substring keeps
+// core.ErrUnderpriced from matching core.ErrReplaceUnderpriced.
+func SentinelError(sentinel error) ExpectedError {
+	return ExpectedError{Code: DefaultErrorCode, Message: sentinel.Error(), Mode: MatchPrefix}
+}
+
+// Expects exactly the given message with any code
+func ErrorMessage(message string) ExpectedError {
+	return ExpectedError{Message: message, Mode: MatchExact}
+}
+
+// Expects a message starting with prefix, for messages that end with details
+func ErrorWithPrefix(prefix string) ExpectedError {
+	return ExpectedError{Message: prefix, Mode: MatchPrefix}
+}
+
+// Expects an eth_call that reverts with the given revert data. The message has the
+// decoded reason appended if the data is an Error(string).
+func RevertError(data []byte) ExpectedError {
+	return ExpectedError{Code: RevertErrorCode, Message: "execution reverted", Mode: MatchPrefix, Data: hexutil.Encode(data)}
+}
+
+func (expected ExpectedError) String() string {
+	description := fmt.Sprintf("error %s %q", expected.Mode, expected.Message)
+	if expected.Code != 0 {
+		description += fmt.Sprintf(" with code %d", expected.Code)
+	}
+	if expected.Data != "" {
+		description += fmt.Sprintf(" with data %s", expected.Data)
+	}
+	return description
+}
+
+func (expected ExpectedError) matchMessage(message string) (bool, error) {
+	switch expected.Mode {
+	case MatchExact:
+		return message == expected.Message, nil
+	case MatchPrefix:
+		return strings.HasPrefix(message, expected.Message), nil
+	}
+	return false, fmt.Errorf("unknown match mode %v", expected.Mode)
+}
+
+// Match returns nil if err is the expected error. Otherwise the returned error lists
+// every part of err that differs from the expectation.
+func (expected ExpectedError) Match(err error) error {
+	if err == nil {
+		return fmt.Errorf("expected %v but got no error instead", expected)
+	}
+
+	var diff []string
+	matched, matchErr := expected.matchMessage(err.Error())
+	if matchErr != nil {
+		return matchErr
+	}
+	if !matched {
+		diff = append(diff, fmt.Sprintf("message: expected %s %q, got %q", expected.Mode, expected.Message, err.Error()))
+	}
+	if expected.Code != 0 {
+		if rpcErr, ok := err.(rpc.Error); !ok {
+			diff = append(diff, fmt.Sprintf("code: expected %d, got an error without code (%T)", expected.Code, err))
+		} else if rpcErr.ErrorCode() != expected.Code {
+			diff = append(diff, fmt.Sprintf("code: expected %d, got %d", expected.Code, rpcErr.ErrorCode()))
+		}
+	}
+	if expected.Data != "" {
+		if dataErr, ok := err.(rpc.DataError); !ok || dataErr.ErrorData() == nil {
+			diff = append(diff, fmt.Sprintf("data: expected %s, got no data", expected.Data))
+		} else if data := fmt.Sprint(dataErr.ErrorData()); data != expected.Data {
+			diff = append(diff, fmt.Sprintf("data: expected %s, got %s", expected.Data, data))
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unexpected error '%v':\n  %s", err, strings.Join(diff, "\n  "))
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"hertzTests/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Parlia sends 1/2^SystemRewardPercent of the fees of a block to the system reward
+// contract as long as its balance is below MaxSystemBalance, must match the node
+const SystemRewardPercent = 4
+
+var MaxSystemBalance = new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+
+var ValidatorContract = common.HexToAddress(systemcontracts.ValidatorContract)
+var SystemRewardContract = common.HexToAddress(systemcontracts.SystemRewardContract)
+
+// The contracts Parlia sends system transactions to, must match the node
+var SystemContracts = map[common.Address]bool{
+	common.HexToAddress(systemcontracts.ValidatorContract):          true,
+	common.HexToAddress(systemcontracts.SlashContract):              true,
+	common.HexToAddress(systemcontracts.SystemRewardContract):       true,
+	common.HexToAddress(systemcontracts.LightClientContract):        true,
+	common.HexToAddress(systemcontracts.RelayerHubContract):         true,
+	common.HexToAddress(systemcontracts.GovHubContract):             true,
+	common.HexToAddress(systemcontracts.TokenHubContract):           true,
+	common.HexToAddress(systemcontracts.RelayerIncentivizeContract): true,
+	common.HexToAddress(systemcontracts.CrossChainContract):         true,
+}
+
+// The validator set contract burns part of its deposits once a burn ratio is set
+var burnAddress = common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+
+// Returns the part of the fees of a block Parlia sends to the system reward contract,
+// which depends on the balance of the contract before the block
+func ExpectedSystemReward(client *ethclient.Client, fees *big.Int, blockNr *big.Int) (*big.Int, error) {
+	balance, err := client.BalanceAt(context.Background(), SystemRewardContract, new(big.Int).Sub(blockNr, common.Big1))
+	if err != nil {
+		return nil, err
+	}
+	if balance.Cmp(MaxSystemBalance) >= 0 {
+		return new(big.Int), nil
+	}
+	return new(big.Int).Rsh(fees, SystemRewardPercent), nil
+}
+
+// Returns the effectiveGasPrice field of a transaction receipt, which ethclient doesn't decode
+func EffectiveGasPrice(rpcClient *rpc.Client, txHash common.Hash) (*big.Int, error) {
+	var receipt struct {
+		EffectiveGasPrice *hexutil.Big `json:"effectiveGasPrice"`
+	}
+	err := rpcClient.CallContext(context.Background(), &receipt, "eth_getTransactionReceipt", txHash)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.EffectiveGasPrice == nil {
+		return nil, fmt.Errorf("receipt of transaction %v has no effectiveGasPrice", txHash)
+	}
+	return receipt.EffectiveGasPrice.ToInt(), nil
+}
+
+// Returns the price per gas a transaction pays in a block with the given base fee:
+// min(gasFeeCap, baseFee + gasTipCap). For legacy and access list transactions both
+// caps are the gas price.
+func ExpectedEffectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return new(big.Int).Set(tx.GasPrice())
+	}
+	price := new(big.Int).Add(baseFee, tx.GasTipCap())
+	if price.Cmp(tx.GasFeeCap()) > 0 {
+		price.Set(tx.GasFeeCap())
+	}
+	return price
+}
+
+// Returns the balance change of an account caused by a block
+func balanceDelta(client *ethclient.Client, account common.Address, blockNr *big.Int) (*big.Int, error) {
+	before, err := client.BalanceAt(context.Background(), account, new(big.Int).Sub(blockNr, common.Big1))
+	if err != nil {
+		return nil, err
+	}
+	after, err := client.BalanceAt(context.Background(), account, blockNr)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Sub(after, before), nil
+}
+
+// VerifyFeeAccounting checks the fees paid by a mined transaction and where the fees
+// of its block went:
+//   - effectiveGasPrice of the receipt is min(gasFeeCap, baseFee + gasTipCap)
+//   - the balance of the sender changes by the values it received minus the values it
+//     sent and gasUsed * effectiveGasPrice of every transaction it sent in the block
+//   - the fee total of the block is collected by the miner and distributed during
+//     finalization: 1/16 to the system reward contract while its balance is below
+//     100 ether, the rest to the validator set contract
+//
+// Value transfers made by contracts are not accounted for, so the sender must not
+// receive or send value through contract calls in the same block.
+func VerifyFeeAccounting(rpcClient *rpc.Client, txHash common.Hash) error {
+	client := ethclient.NewClient(rpcClient)
+	receipt, err := client.TransactionReceipt(context.Background(), txHash)
+	if err != nil {
+		return err
+	}
+	block, err := client.BlockByNumber(context.Background(), receipt.BlockNumber)
+	if err != nil {
+		return err
+	}
+	blockNr := block.Number()
+	signer := types.LatestSignerForChainID(config.ChainId)
+
+	var sender common.Address
+	for _, tx := range block.Transactions() {
+		if tx.Hash() == txHash {
+			sender, err = types.Sender(signer, tx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Replay the value and fee movements of every transaction in the block
+	fees := new(big.Int)
+	senderDelta := new(big.Int)
+	var validatorDeposit, systemReward *big.Int
+	for _, tx := range block.Transactions() {
+		txReceipt, err := client.TransactionReceipt(context.Background(), tx.Hash())
+		if err != nil {
+			return err
+		}
+		effectiveGasPrice, err := EffectiveGasPrice(rpcClient, tx.Hash())
+		if err != nil {
+			return err
+		}
+		if expected := ExpectedEffectiveGasPrice(tx, block.BaseFee()); effectiveGasPrice.Cmp(expected) != 0 {
+			return fmt.Errorf("effectiveGasPrice of transaction %v is %v, expected %v", tx.Hash(), effectiveGasPrice, expected)
+		}
+		fee := new(big.Int).Mul(new(big.Int).SetUint64(txReceipt.GasUsed), effectiveGasPrice)
+		fees.Add(fees, fee)
+
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return err
+		}
+		// System transactions of the miner transfer the collected fees, they are free
+		if from == block.Coinbase() && tx.GasPrice().Sign() == 0 && tx.To() != nil {
+			switch *tx.To() {
+			case ValidatorContract:
+				validatorDeposit = tx.Value()
+			case SystemRewardContract:
+				systemReward = tx.Value()
+			}
+		}
+		if from == sender {
+			senderDelta.Sub(senderDelta, fee)
+			if txReceipt.Status == types.ReceiptStatusSuccessful {
+				senderDelta.Sub(senderDelta, tx.Value())
+			}
+		}
+		if tx.To() != nil && *tx.To() == sender && txReceipt.Status == types.ReceiptStatusSuccessful {
+			senderDelta.Add(senderDelta, tx.Value())
+		}
+	}
+	// The miner receives the fee total before distributing it
+	if sender == block.Coinbase() {
+		senderDelta.Add(senderDelta, fees)
+	}
+
+	delta, err := balanceDelta(client, sender, blockNr)
+	if err != nil {
+		return err
+	}
+	if delta.Cmp(senderDelta) != 0 {
+		return fmt.Errorf("balance of sender %v changed by %v in block %v, expected %v", sender, delta, blockNr, senderDelta)
+	}
+
+	// All the fees have to leave the system address during finalization
+	systemBalance, err := client.BalanceAt(context.Background(), consensus.SystemAddress, blockNr)
+	if err != nil {
+		return err
+	}
+	if systemBalance.Sign() != 0 {
+		return fmt.Errorf("balance of the system address is %v after block %v, expected 0", systemBalance, blockNr)
+	}
+	if fees.Sign() == 0 {
+		if validatorDeposit != nil || systemReward != nil {
+			return fmt.Errorf("block %v distributed fees although it collected none", blockNr)
+		}
+		return nil
+	}
+
+	expectedReward, err := ExpectedSystemReward(client, fees, blockNr)
+	if err != nil {
+		return err
+	}
+	expectedDeposit := new(big.Int).Sub(fees, expectedReward)
+
+	if expectedReward.Sign() == 0 && systemReward != nil {
+		return fmt.Errorf("block %v sent %v to the system reward contract, expected nothing", blockNr, systemReward)
+	}
+	if expectedReward.Sign() != 0 && (systemReward == nil || systemReward.Cmp(expectedReward) != 0) {
+		return fmt.Errorf("block %v sent %v to the system reward contract, expected %v", blockNr, systemReward, expectedReward)
+	}
+	if validatorDeposit == nil || validatorDeposit.Cmp(expectedDeposit) != 0 {
+		return fmt.Errorf("block %v deposited %v to the validator set contract, expected %v", blockNr, validatorDeposit, expectedDeposit)
+	}
+
+	rewardDelta, err := balanceDelta(client, SystemRewardContract, blockNr)
+	if err != nil {
+		return err
+	}
+	if rewardDelta.Cmp(expectedReward) != 0 {
+		return fmt.Errorf("balance of the system reward contract changed by %v in block %v, expected %v", rewardDelta, blockNr, expectedReward)
+	}
+	validatorDelta, err := balanceDelta(client, ValidatorContract, blockNr)
+	if err != nil {
+		return err
+	}
+	burnDelta, err := balanceDelta(client, burnAddress, blockNr)
+	if err != nil {
+		return err
+	}
+	if total := new(big.Int).Add(validatorDelta, burnDelta); total.Cmp(expectedDeposit) != 0 {
+		return fmt.Errorf("balance of the validator set contract and the burn address changed by %v in block %v, expected %v", total, blockNr, expectedDeposit)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"hertzTests/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// TxParams are the fields of a transaction of any type. Legacy and access list
+// transactions use GasFeeCap as their gas price and ignore GasTipCap, legacy
+// transactions also ignore ChainID and AccessList. A nil ChainID is config.ChainId.
+type TxParams struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasFeeCap  *big.Int
+	GasTipCap  *big.Int
+	Gas        uint64
+	To         *common.Address
+	Value      *big.Int
+	Data       []byte
+	AccessList types.AccessList
+}
+
+func (p TxParams) chainID() *big.Int {
+	if p.ChainID == nil {
+		return config.ChainId
+	}
+	return p.ChainID
+}
+
+// Returns an unsigned transaction of the given type with the fields of p
+func NewTx(txType byte, p TxParams) (*types.Transaction, error) {
+	switch txType {
+	case types.LegacyTxType:
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    p.Nonce,
+			GasPrice: p.GasFeeCap,
+			Gas:      p.Gas,
+			To:       p.To,
+			Value:    p.Value,
+			Data:     p.Data,
+		}), nil
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    p.chainID(),
+			Nonce:      p.Nonce,
+			GasPrice:   p.GasFeeCap,
+			Gas:        p.Gas,
+			To:         p.To,
+			Value:      p.Value,
+			Data:       p.Data,
+			AccessList: p.AccessList,
+		}), nil
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    p.chainID(),
+			Nonce:      p.Nonce,
+			GasFeeCap:  p.GasFeeCap,
+			GasTipCap:  p.GasTipCap,
+			Gas:        p.Gas,
+			To:         p.To,
+			Value:      p.Value,
+			Data:       p.Data,
+			AccessList: p.AccessList,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown transaction type %d", txType)
+}
+
+// Returns a transaction of the given type with the fields of p, signed with key by the
+// latest signer of the chain id of p. Legacy transactions are signed with EIP-155.
+func SignNewTx(txType byte, p TxParams, key *ecdsa.PrivateKey) (*types.Transaction, error) {
+	tx, err := NewTx(txType, p)
+	if err != nil {
+		return nil, err
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(p.chainID()), key)
+}
+
+// Generates count accounts, funds each of them with 1 ether from the account of key
+// and waits until the funding transactions are mined
+func FundAccounts(client *ethclient.Client, key *ecdsa.PrivateKey, count int) ([]*ecdsa.PrivateKey, error) {
+	funder := crypto.PubkeyToAddress(key.PublicKey)
+	nonce, err := client.PendingNonceAt(context.Background(), funder)
+	if err != nil {
+		return nil, err
+	}
+	gasPrice, err := client.SuggestGasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*ecdsa.PrivateKey, count)
+	txHashes := make([]common.Hash, count)
+	for i := range keys {
+		keys[i], err = crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		address := crypto.PubkeyToAddress(keys[i].PublicKey)
+		tx, err := SignNewTx(types.LegacyTxType, TxParams{
+			Nonce:     nonce + uint64(i),
+			GasFeeCap: gasPrice,
+			Gas:       params.TxGas,
+			To:        &address,
+			Value:     big.NewInt(params.Ether),
+		}, key)
+		if err != nil {
+			return nil, err
+		}
+		err = client.SendTransaction(context.Background(), tx)
+		if err != nil {
+			return nil, err
+		}
+		txHashes[i] = tx.Hash()
+	}
+	for _, txHash := range txHashes {
+		receipt, err := WaitForTransactionReceipt(client, txHash)
+		if err != nil {
+			return nil, err
+		}
+		if receipt.Status != 1 {
+			return nil, fmt.Errorf("funding of an account failed. Receipt: %+v", receipt)
+		}
+	}
+	return keys, nil
+}